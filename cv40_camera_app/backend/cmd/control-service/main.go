@@ -1,9 +1,12 @@
 package main
 
 import (
+    "context"
+    "errors"
     "log"
     "os"
     "path/filepath"
+    lt "lt/client/go"
     "cv40-camera-backend/internal/api"
     "cv40-camera-backend/internal/config"
     "cv40-camera-backend/internal/cv40"
@@ -27,25 +30,93 @@ func main() {
     st := state.NewStore()
     st.Set(state.BOOTING)
 
+    // CV40_LT_REPLAY drives the service from a capture, CV40_LT_CAPTURE records one
     client := cv40.NewRealClient(cfg)
-    if err := client.Health(); err != nil {
+    if path := os.Getenv("CV40_LT_REPLAY"); path != "" {
+        f, err := os.Open(path)
+        if err != nil { log.Fatal(err) }
+        client, err = cv40.NewReplayClient(cfg, f, os.Getenv("CV40_LT_REPLAY_REALTIME") != "")
+        f.Close()
+        if err != nil { log.Fatal(err) }
+    } else if path := os.Getenv("CV40_LT_CAPTURE"); path != "" {
+        f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+        if err != nil { log.Fatal(err) }
+        defer f.Close()
+        client.Record(f)
+    }
+
+    // The server watches the agent calls from the first one: an agent
+    // updating at boot puts the service in UPDATING until it is done
+    ov := overlay.NewEngine(client, cfg)
+    sm := storage.NewManager(cfg)
+    srv := api.NewServer(cfg, client, ov, sm, st, ev)
+    if err := client.Health(); errors.Is(err, lt.ErrUpdating) {
+        log.Println("agent updating at boot")
+    } else if err != nil {
         st.Set(state.ERROR_BLOCKING)
         log.Fatal(err)
     }
 
-    ov := overlay.NewEngine(client, cfg)
+    // An agent version out of the supported range is refused, a missing
+    // feature the config uses degrades the service
+    var agentReason string // Why the agent degraded the service, "" if it did not
+    if caps, err := client.Capabilities(context.Background()); err != nil {
+        log.Println("agent capabilities:", err)
+    } else if err := caps.Check(); err != nil {
+        st.SetReason(state.ERROR_BLOCKING, err.Error())
+        log.Fatal(err)
+    } else if agentReason = cfg.CheckFeatures(caps); agentReason != "" {
+        st.SetReason(state.DEGRADED, agentReason)
+        log.Println("degraded:", agentReason)
+    } else {
+        log.Printf("agent %s %s, supported %s", caps.Version, caps.Revision, lt.SupportedVersions)
+    }
+
+    // Configured devices must exist, a capture may not hold the inventory
+    if inv, err := client.Discover(context.Background()); err != nil {
+        log.Println("device discovery:", err)
+    } else if err := cfg.CheckDevices(inv); err != nil {
+        st.Set(state.ERROR_BLOCKING)
+        log.Fatal("config: ", err)
+    } else {
+        for _, b := range inv.Boards { log.Printf("agent %s board %d %s sn %d: %d cameras, %d outputs", inv.Version, b.ID, b.Model, b.SN, len(b.Cameras), len(b.Outputs)) }
+    }
+
     if err := ov.InitOutput(); err != nil {
         log.Println("overlay init:", err)
     }
 
-    sm := storage.NewManager(cfg)
+    // Agent restarts reset the canvas and output overlay, and may come with
+    // an update: its version is checked again, and a degradation it caused
+    // ends once the agent has the features
+    client.OnConnEvent(func(e lt.ConnEvent) {
+        log.Println("agent", e.Agent, e.State, e.Err)
+        ev.Broadcast("agent_connection", map[string]interface{}{"state": e.State.String(), "agent": e.Agent})
+        if e.State == lt.Reconnected {
+            if err := ov.InitOutput(); err != nil { log.Println("overlay init:", err) }
+            caps, err := client.Capabilities(context.Background())
+            if err != nil { log.Println("agent capabilities:", err); return }
+            reason := cfg.CheckFeatures(caps)
+            if err := caps.Check(); err != nil { reason = err.Error() }
+            if reason != "" {
+                st.SetReason(state.DEGRADED, reason)
+                log.Println("degraded:", reason)
+                ev.Broadcast("agent_degraded", map[string]interface{}{"reason": reason, "version": caps.Version})
+            } else if agentReason != "" && st.Recover(agentReason) {
+                log.Printf("agent %s has the features again, ready", caps.Version)
+                ev.Broadcast("agent_degraded", map[string]interface{}{"reason": "", "version": caps.Version})
+            }
+            agentReason = reason
+        }
+    })
+
     if err := sm.InitTargets(); err != nil {
-        st.Set(state.DEGRADED)
+        st.SetReason(state.DEGRADED, "storage: "+err.Error())
         log.Println("storage init:", err)
     }
 
-    st.Set(state.READY)
+    // A degraded boot stays DEGRADED, with its reason
+    if st.Get() == state.BOOTING { st.Set(state.READY) }
 
-    srv := api.NewServer(cfg, client, ov, sm, st, ev)
     log.Fatal(srv.Start())
 }
@@ -1,6 +1,6 @@
 module cv40-camera-backend
 
-go 1.22.5
+go 1.23
 
 toolchain go1.24.6
 
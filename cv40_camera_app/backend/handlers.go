@@ -13,6 +13,7 @@ import (
 	"time"
 
 	lt "lt/client/go"
+	"lt/client/go/whitebalance"
 )
 
 type Server struct {
@@ -27,6 +28,9 @@ type Server struct {
 
 var app = &Server{preset: "arthroscopy"}
 
+// Phase 1 drives camera 0 on board 0
+var camera = lt.At("cv40").Board(0).Camera(0)
+
 // POST /api/session/start
 // Body: { "doctor":..., "hospital":..., "surgery":..., "patient":..., "technician":... }
 func handleSessionStart(w http.ResponseWriter, r *http.Request) {
@@ -82,7 +86,7 @@ func handleCapture(w http.ResponseWriter, r *http.Request) {
 
 	// Validate camera present
 	var cam lt.Camera
-	if err := client.Get("cv40:/0/camera/0", &cam); err != nil {
+	if err := client.Get(camera.URL(), &cam); err != nil {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
 		return
 	}
@@ -95,7 +99,7 @@ func handleCapture(w http.ResponseWriter, r *http.Request) {
 		folder := filepath.Join(root, base)
 		_ = os.MkdirAll(folder, 0o755)
 		// Create still capture worker to that folder
-		err := client.Post("cv40:/0/camera/0/file", lt.ImageFileWorker{Media: "image/jpeg", Location: folder}, nil)
+		err := client.Post(camera.FileURL(), lt.ImageFileWorker{Media: "image/jpeg", Location: folder}, nil)
 		if !errors.Is(err, lt.ErrRedirect) {
 			results = append(results, map[string]string{"destination": folder, "status": "error", "error": err.Error()})
 			continue
@@ -128,7 +132,7 @@ func handleRecordingStart(w http.ResponseWriter, r *http.Request) {
 	for _, root := range dests {
 		folder := filepath.Join(root, base)
 		_ = os.MkdirAll(folder, 0o755)
-		err := client.Post("cv40:/0/camera/0/file", lt.VideoFileWorker{
+		err := client.Post(camera.FileURL(), lt.VideoFileWorker{
 			Media:    "video/mp4",
 			Location: folder,
 			// Extra: defaults; you can tune HW/codec later on the device
@@ -221,32 +225,43 @@ func handleRecordingStop(w http.ResponseWriter, r *http.Request) {
 }
 
 // POST /api/white-balance
+// One-push white balance on the target at the center of the image, eg gauze.
+// Mock cameras serve no frames, their balance is reset instead.
 func handleWhiteBalance(w http.ResponseWriter, r *http.Request) {
-	// Simple implementation: set temperature and balance to defaults/neutral.
-	// On the actual device we can compute balance from scene or call an SDK WB op if present.
 	client := createClient()
 	defer client.Close()
-	wb := lt.CameraWhite{Temperature: 6500}
-	if err := client.Post("cv40:/0/camera/0/white", &wb, nil); err != nil {
-		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+	if client.mock {
+		if _, _, err := camera.White().Patch(client, lt.JSON{"balance": [3]float64{1, 1, 1}}); err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		broadcastWhiteBalance(true, nil)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "white-balance-set"})
 		return
 	}
-	broadcastWhiteBalance(true)
-	writeJSON(w, http.StatusOK, map[string]string{"status": "white-balance-set"})
+	res, err := whitebalance.Run(r.Context(), client.real, camera.URL(), whitebalance.Options{})
+	if err != nil {
+		broadcastWhiteBalance(false, map[string]interface{}{"error": err.Error()})
+		status := http.StatusBadGateway
+		var f whitebalance.Failure
+		if errors.As(err, &f) {
+			status = http.StatusUnprocessableEntity
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	broadcastWhiteBalance(true, map[string]interface{}{"balance": res.Balance, "iterations": res.Iterations})
+	writeJSON(w, http.StatusOK, map[string]any{"status": "white-balance-set", "balance": res.Balance})
 }
 
 // GET /api/settings -> aggregate of visuals/colors/white/exposure
 func handleGetSettings(w http.ResponseWriter, r *http.Request) {
 	client := createClient()
 	defer client.Close()
-	var visuals lt.CameraVisuals
-	var colors lt.CameraColors
-	var white lt.CameraWhite
-	var exposure lt.CameraExposure
-	_ = client.Get("cv40:/0/camera/0/visuals", &visuals)
-	_ = client.Get("cv40:/0/camera/0/colors", &colors)
-	_ = client.Get("cv40:/0/camera/0/white", &white)
-	_ = client.Get("cv40:/0/camera/0/exposure", &exposure)
+	visuals, _ := camera.Visuals().Get(client)
+	colors, _ := camera.Colors().Get(client)
+	white, _ := camera.White().Get(client)
+	exposure, _ := camera.Exposure().Get(client)
 	writeJSON(w, http.StatusOK, map[string]any{
 		"visuals":  visuals,
 		"colors":   colors,
@@ -257,48 +272,34 @@ func handleGetSettings(w http.ResponseWriter, r *http.Request) {
 
 // POST /api/settings -> body may contain partial updates
 func handlePostSettings(w http.ResponseWriter, r *http.Request) {
-	var req map[string]json.RawMessage
+	var req map[string]lt.JSON
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
 	client := createClient()
 	defer client.Close()
-	if v, ok := req["visuals"]; ok {
-		var visuals lt.CameraVisuals
-		if err := json.Unmarshal(v, &visuals); err == nil {
-			_ = client.Post("cv40:/0/camera/0/visuals", &visuals, nil)
-			if visuals.Zoom > 0 {
-				broadcastParameterChange("Zoom", visuals.Zoom)
-			}
-			if visuals.Sharpness > 0 {
-				broadcastParameterChange("Sharpness", visuals.Sharpness)
-			}
-		}
+	// Sections are patched, fields missing from the body keep their value
+	sections := []struct {
+		name  string
+		patch func(lt.JSON) ([]lt.Change, error)
+	}{
+		{"visuals", func(p lt.JSON) ([]lt.Change, error) { _, c, err := camera.Visuals().Patch(client, p); return c, err }},
+		{"colors", func(p lt.JSON) ([]lt.Change, error) { _, c, err := camera.Colors().Patch(client, p); return c, err }},
+		{"white", func(p lt.JSON) ([]lt.Change, error) { _, c, err := camera.White().Patch(client, p); return c, err }},
+		{"exposure", func(p lt.JSON) ([]lt.Change, error) { _, c, err := camera.Exposure().Patch(client, p); return c, err }},
 	}
-	if v, ok := req["colors"]; ok {
-		var colors lt.CameraColors
-		if err := json.Unmarshal(v, &colors); err == nil {
-			_ = client.Post("cv40:/0/camera/0/colors", &colors, nil)
-			broadcastParameterChange("Brightness", float64(colors.Brightness))
-			broadcastParameterChange("Contrast", float64(colors.Contrast))
-			broadcastParameterChange("Saturation", float64(colors.Saturation))
-			broadcastParameterChange("Hue", float64(colors.Hue))
-		}
-	}
-	if v, ok := req["white"]; ok {
-		var white lt.CameraWhite
-		if err := json.Unmarshal(v, &white); err == nil {
-			_ = client.Post("cv40:/0/camera/0/white", &white, nil)
-			broadcastParameterChange("Temperature", float64(white.Temperature))
+	for _, section := range sections {
+		p, ok := req[section.name]
+		if !ok {
+			continue
 		}
-	}
-	if v, ok := req["exposure"]; ok {
-		var exposure lt.CameraExposure
-		if err := json.Unmarshal(v, &exposure); err == nil {
-			_ = client.Post("cv40:/0/camera/0/exposure", &exposure, nil)
-			broadcastParameterChange("LowLightGain", exposure.LowLightGain)
+		changes, err := section.patch(p)
+		if err != nil {
+			writeJSON(w, settingsStatus(err), map[string]string{"error": section.name + ": " + err.Error()})
+			return
 		}
+		broadcastChanges(changes)
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
@@ -316,53 +317,10 @@ func handleApplyPreset(w http.ResponseWriter, r *http.Request) {
 	client := createClient()
 	defer client.Close()
 
-    switch req.Preset {
-	case "arthroscopy":
-		// Default arthroscopy settings
-		colors := lt.CameraColors{
-			Brightness: 10,
-			Contrast:   15,
-			Saturation: 5,
-			Hue:        0,
-			Gamma:      1.0,
-			ColorGain:  [3]float64{1.0, 1.0, 1.0},
-		}
-		visuals := lt.CameraVisuals{
-			Zoom:      1.0,
-			Sharpness: 0.7,
-		}
-		white := lt.CameraWhite{
-			Temperature: 6500,
-		}
-		_ = client.Post("cv40:/0/camera/0/colors", &colors, nil)
-		_ = client.Post("cv40:/0/camera/0/visuals", &visuals, nil)
-		_ = client.Post("cv40:/0/camera/0/white", &white, nil)
-
-	case "red_boost":
-		// Red boost preset - enhanced reds and yellows for better tissue contrast
-		colors := lt.CameraColors{
-			Brightness: 20,
-			Contrast:   25,
-			Saturation: 15,
-			Hue:        -5,
-			Gamma:      0.9,
-			ColorGain:  [3]float64{1.2, 0.95, 0.85}, // Boost red, slightly reduce green/blue
-		}
-		visuals := lt.CameraVisuals{
-			Zoom:      1.0,
-			Sharpness: 0.8,
-		}
-		white := lt.CameraWhite{
-			Temperature: 5800, // Warmer temperature
-		}
-		_ = client.Post("cv40:/0/camera/0/colors", &colors, nil)
-		_ = client.Post("cv40:/0/camera/0/visuals", &visuals, nil)
-		_ = client.Post("cv40:/0/camera/0/white", &white, nil)
-
-    default:
-        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown preset"})
-        return
-    }
+	if err := applyPreset(client, req.Preset); err != nil {
+		writeJSON(w, settingsStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
     app.mu.Lock()
     app.preset = req.Preset
     app.mu.Unlock()
@@ -390,14 +348,14 @@ func handleControllerButton(w http.ResponseWriter, r *http.Request) {
         client := createClient()
         defer client.Close()
         var cam lt.Camera
-        if err := client.Get("cv40:/0/camera/0", &cam); err != nil {
+        if err := client.Get(camera.URL(), &cam); err != nil {
             writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
             return
         }
         for _, root := range dests {
             folder := filepath.Join(root, base)
             _ = os.MkdirAll(folder, 0o755)
-            err := client.Post("cv40:/0/camera/0/file", lt.ImageFileWorker{Media: "image/jpeg", Location: folder}, nil)
+            err := client.Post(camera.FileURL(), lt.ImageFileWorker{Media: "image/jpeg", Location: folder}, nil)
             if !errors.Is(err, lt.ErrRedirect) {
                 writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
                 return
@@ -432,7 +390,7 @@ func handleControllerButton(w http.ResponseWriter, r *http.Request) {
             for _, root := range dests {
                 folder := filepath.Join(root, base)
                 _ = os.MkdirAll(folder, 0o755)
-                err := client.Post("cv40:/0/camera/0/file", lt.VideoFileWorker{Media: "video/mp4", Location: folder}, nil)
+                err := client.Post(camera.FileURL(), lt.VideoFileWorker{Media: "video/mp4", Location: folder}, nil)
                 if !errors.Is(err, lt.ErrRedirect) {
                     writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
                     return
@@ -465,36 +423,16 @@ func handleControllerButton(w http.ResponseWriter, r *http.Request) {
         broadcastRecordingState(true, true)
         writeJSON(w, http.StatusOK, map[string]string{"status": "paused"})
     case "wb":
-        client := createClient()
-        defer client.Close()
-        wb := lt.CameraWhite{Temperature: 6500}
-        if err := client.Post("cv40:/0/camera/0/white", &wb, nil); err != nil {
-            writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
-            return
-        }
-        broadcastWhiteBalance(true)
-        writeJSON(w, http.StatusOK, map[string]string{"status": "white-balance-set"})
+        handleWhiteBalance(w, r)
     case "preset":
         app.mu.Lock(); current := app.preset; app.mu.Unlock()
         next := "arthroscopy"
         if current == "arthroscopy" { next = "red_boost" }
         client := createClient()
         defer client.Close()
-        switch next {
-        case "arthroscopy":
-            colors := lt.CameraColors{Brightness: 10, Contrast: 15, Saturation: 5, Hue: 0, Gamma: 1.0, ColorGain: [3]float64{1.0,1.0,1.0}}
-            visuals := lt.CameraVisuals{Zoom: 1.0, Sharpness: 0.7}
-            white := lt.CameraWhite{Temperature: 6500}
-            _ = client.Post("cv40:/0/camera/0/colors", &colors, nil)
-            _ = client.Post("cv40:/0/camera/0/visuals", &visuals, nil)
-            _ = client.Post("cv40:/0/camera/0/white", &white, nil)
-        case "red_boost":
-            colors := lt.CameraColors{Brightness: 20, Contrast: 25, Saturation: 15, Hue: -5, Gamma: 0.9, ColorGain: [3]float64{1.2,0.95,0.85}}
-            visuals := lt.CameraVisuals{Zoom: 1.0, Sharpness: 0.8}
-            white := lt.CameraWhite{Temperature: 5800}
-            _ = client.Post("cv40:/0/camera/0/colors", &colors, nil)
-            _ = client.Post("cv40:/0/camera/0/visuals", &visuals, nil)
-            _ = client.Post("cv40:/0/camera/0/white", &white, nil)
+        if err := applyPreset(client, next); err != nil {
+            writeJSON(w, settingsStatus(err), map[string]string{"error": err.Error()})
+            return
         }
         app.mu.Lock(); app.preset = next; app.mu.Unlock()
         broadcastPresetApplied(next)
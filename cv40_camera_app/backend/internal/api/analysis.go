@@ -0,0 +1,75 @@
+package api
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "lt/client/go/stats"
+)
+
+type frameStats struct {
+    Size  [2]int `json:"size"`
+    Media string `json:"media"`
+    stats.Stats
+}
+
+// Statistics of one live frame, over the auto exposure window by default:
+// ?roi=full for the whole frame, ?roi=x,y,width,height in frame pixels, and
+// ?bins=n for coarser histograms
+func (s *Server) handleAnalysisFrame(w http.ResponseWriter, r *http.Request) {
+    roi, window, opts, err := analysisQuery(r.URL.Query())
+    if err != nil { w.WriteHeader(http.StatusBadRequest); w.Write([]byte(err.Error())); return }
+
+    img, err := s.cli.GrabFrame(r.Context(), "image/yuv422")
+    if err != nil { writeAgentError(w, err); return }
+    b := img.Bounds()
+    size := [2]int{b.Dx(), b.Dy()}
+    switch roi {
+    case "full":
+    case "exposure":
+        // The window is in input video pixels, the frame may be scaled
+        exposure, err := s.cli.GetExposure()
+        if err != nil { writeAgentError(w, err); return }
+        cam, err := s.cli.Camera(r.Context())
+        if err != nil { writeAgentError(w, err); return }
+        opts.ROI = stats.Window(exposure.Window, cam.Video.Size, size)
+    default:
+        opts.ROI = stats.Window(window, size, size)
+        if opts.ROI.Intersect(b).Empty() {
+            w.WriteHeader(http.StatusBadRequest)
+            fmt.Fprintf(w, "roi outside the %dx%d frame", size[0], size[1])
+            return
+        }
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(frameStats{Size: size, Media: "image/yuv422", Stats: stats.Compute(img, opts)})
+}
+
+func analysisQuery(q url.Values) (roi string, window [4]int, opts stats.Options, err error) {
+    if v := q.Get("bins"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > 256 { return "", window, opts, errors.New("bins: 1 to 256") }
+        opts.Bins = n
+    }
+    roi = q.Get("roi")
+    switch roi {
+    case "":
+        return "exposure", window, opts, nil
+    case "exposure", "full":
+        return roi, window, opts, nil
+    }
+    errROI := errors.New("roi: exposure, full or x,y,width,height")
+    parts := strings.Split(roi, ",")
+    if len(parts) != 4 { return "", window, opts, errROI }
+    for i, p := range parts {
+        n, err := strconv.Atoi(strings.TrimSpace(p))
+        if err != nil || n < 0 { return "", window, opts, errROI }
+        window[i] = n
+    }
+    if window[2] == 0 || window[3] == 0 { return "", window, opts, errROI }
+    return "window", window, opts, nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "time"
+    lt "lt/client/go"
+)
+
+// Camera head buttons drive the service like the ESP32 controller: button
+// n+1 of the controller mapping, a click as a short press and a long press as
+// a long one. The watch is retried while the camera has no buttons.
+func (s *Server) watchCameraButtons(ctx context.Context) {
+    for {
+        events, err := s.cli.WatchButtons(ctx, lt.ButtonOptions{OnError: func(err error) { log.Println("camera buttons:", err) }})
+        if err != nil {
+            log.Println("camera buttons:", err)
+            select {
+            case <-ctx.Done(): return
+            case <-time.After(5 * time.Second): continue
+            }
+        }
+        for e := range events {
+            press := ""
+            switch e.Type {
+            case lt.ButtonClick: press = "short"
+            case lt.ButtonLongPress: press = "long"
+            default: continue
+            }
+            w := s.invoke(s.handleControllerEvent, map[string]any{"deviceId": "camera-head", "btn": e.Button + 1, "press": press})
+            if w.Code >= 300 { log.Printf("camera button %d %s: %d %s", e.Button+1, press, w.Code, w.Body.String()) }
+        }
+        return
+    }
+}
+
+// invoke runs a tool handler for an internal trigger, with a JSON body
+func (s *Server) invoke(h http.HandlerFunc, body any) *httptest.ResponseRecorder {
+    b, _ := json.Marshal(body)
+    w := httptest.NewRecorder()
+    h(w, httptest.NewRequest("POST", "/", bytes.NewReader(b)))
+    return w
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+    lt "lt/client/go"
+)
+
+// Agent call latency in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+    histograms := s.cli.Latency()
+    fmt.Fprintln(w, "# HELP cv40_agent_call_duration_seconds Agent call latency per method and path template")
+    fmt.Fprintln(w, "# TYPE cv40_agent_call_duration_seconds histogram")
+    for _, h := range histograms {
+        labels := fmt.Sprintf(`method=%q,path=%q`, h.Method, h.Path)
+        var n uint64
+        for i, b := range h.Buckets {
+            n += h.Counts[i]
+            fmt.Fprintf(w, "cv40_agent_call_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, b.Seconds(), n)
+        }
+        fmt.Fprintf(w, "cv40_agent_call_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.Count)
+        fmt.Fprintf(w, "cv40_agent_call_duration_seconds_sum{%s} %g\n", labels, h.Sum.Seconds())
+        fmt.Fprintf(w, "cv40_agent_call_duration_seconds_count{%s} %d\n", labels, h.Count)
+    }
+    fmt.Fprintln(w, "# HELP cv40_agent_call_errors_total Failed agent calls per method and path template")
+    fmt.Fprintln(w, "# TYPE cv40_agent_call_errors_total counter")
+    for _, h := range histograms {
+        fmt.Fprintf(w, "cv40_agent_call_errors_total{method=%q,path=%q} %d\n", h.Method, h.Path, h.Errors)
+    }
+    fmt.Fprintln(w, "# HELP cv40_preview_viewers Connected live preview viewers")
+    fmt.Fprintln(w, "# TYPE cv40_preview_viewers gauge")
+    fmt.Fprintf(w, "cv40_preview_viewers %d\n", s.preview.Viewers())
+}
+
+// Agent calls slower than slowAgentMs are flagged, at most every 10s, so a
+// struggling agent shows before recordings drop frames. Worker long polls
+// block by design and are not flagged.
+func (s *Server) watchSlowCalls(next lt.CallFunc) lt.CallFunc {
+    threshold := time.Duration(s.cfg.SlowAgentMs) * time.Millisecond
+    return func(ctx context.Context, method, url string, body, response any) error {
+        start := time.Now()
+        err := next(ctx, method, url, body, response)
+        d := time.Since(start)
+        path := lt.PathTemplate(url)
+        if d < threshold || (method == "GET" && strings.HasPrefix(path, "/client/jobs/")) {
+            return err
+        }
+        s.slowMu.Lock()
+        flag := time.Since(s.slowAt) > 10*time.Second
+        if flag { s.slowAt = time.Now() }
+        s.slowMu.Unlock()
+        if flag {
+            log.Printf("agent slow: %s %s %v", method, url, d)
+            ms := d.Milliseconds()
+            s.ev.Broadcast("agent_slow", map[string]interface{}{"method": method, "path": path, "durationMs": ms})
+            // The toast calls the agent too, off the caller's path
+            go s.ov.Toast(fmt.Sprintf("Agent slow: %d ms", ms), 2000)
+        }
+        return err
+    }
+}
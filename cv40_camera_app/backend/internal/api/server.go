@@ -1,20 +1,25 @@
 package api
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "bytes"
     "io"
     "log"
     "net/http"
     "path/filepath"
+    "sync"
     "time"
     "github.com/gorilla/mux"
     lt "lt/client/go"
+    "lt/client/go/whitebalance"
     "cv40-camera-backend/internal/config"
     "cv40-camera-backend/internal/cv40"
     "cv40-camera-backend/internal/events"
     "cv40-camera-backend/internal/meta"
     "cv40-camera-backend/internal/overlay"
+    "cv40-camera-backend/internal/preview"
     "cv40-camera-backend/internal/recording"
     "cv40-camera-backend/internal/state"
     "cv40-camera-backend/internal/storage"
@@ -30,15 +35,23 @@ type Server struct {
     ev  *events.Hub
     rec *recording.Manager
     lim *tools.Limiter
+    preview *preview.Hub
     sessionID string
     sessionDirs []string
     curPreset string
     stopping bool
+    slowMu sync.Mutex
+    slowAt time.Time
+    signalHeld string // Recording paused or split by a signal loss
+    updMu sync.Mutex
+    updating bool // Waiting for an agent update to end
 }
 
 func NewServer(cfg config.Config, cli *cv40.RealClient, ov *overlay.Engine, sm *storage.Manager, st *state.Store, ev *events.Hub) *Server {
     s := &Server{cfg: cfg, cli: cli, ov: ov, sm: sm, st: st, ev: ev, rec: recording.NewManager(cli)}
     s.lim = tools.NewLimiter(cli, ov, cfg.Ranges)
+    s.preview = preview.NewHub(cli, cfg.PreviewSize, cfg.PreviewFps)
+    cli.Use(s.watchSlowCalls, s.watchUpdating)
     return s
 }
 
@@ -47,18 +60,24 @@ func (s *Server) Start() error {
     r.Use(func(next http.Handler) http.Handler { return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { w.Header().Set("Access-Control-Allow-Origin", "*"); w.Header().Set("Access-Control-Allow-Headers", "Content-Type"); w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS"); if req.Method==http.MethodOptions { w.WriteHeader(http.StatusNoContent); return }; next.ServeHTTP(w, req) }) })
     r.HandleFunc("/health", s.handleHealth).Methods("GET")
     r.HandleFunc("/state", s.handleState).Methods("GET")
+    r.HandleFunc("/devices", s.handleDevices).Methods("GET")
+    r.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
     r.HandleFunc("/events", s.ev.HandleWS)
+    r.Handle("/preview.mjpeg", s.preview).Methods("GET")
     r.HandleFunc("/tools/session/start", s.handleSessionStart).Methods("POST")
     r.HandleFunc("/tools/record/start", s.handleRecordStart).Methods("POST")
     r.HandleFunc("/tools/record/pause", s.handleRecordPause).Methods("POST")
     r.HandleFunc("/tools/record/resume", s.handleRecordResume).Methods("POST")
     r.HandleFunc("/tools/record/stop", s.handleRecordStop).Methods("POST")
+    r.HandleFunc("/tools/analysis/frame", s.handleAnalysisFrame).Methods("GET")
     r.HandleFunc("/tools/photo/capture", s.handlePhotoCapture).Methods("POST")
     r.HandleFunc("/tools/whitebalance/run", s.handleWhiteBalance).Methods("POST")
     r.HandleFunc("/tools/settings/colors", s.handleSetColors).Methods("POST")
     r.HandleFunc("/tools/settings/visuals", s.handleSetVisuals).Methods("POST")
     r.HandleFunc("/tools/preset/apply", s.handlePresetApply).Methods("POST")
     r.HandleFunc("/controller/event", s.handleControllerEvent).Methods("POST")
+    go s.watchSignal(context.Background())
+    if s.cfg.CameraButtons { go s.watchCameraButtons(context.Background()) }
     log.Println("control-service :8083")
     return http.ListenAndServe(":8083", r)
 }
@@ -69,7 +88,17 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
-    json.NewEncoder(w).Encode(map[string]any{"state": s.st.Get()})
+    resp := map[string]any{"state": s.st.Get()}
+    if reason := s.st.Reason(); reason != "" { resp["reason"] = reason }
+    json.NewEncoder(w).Encode(resp)
+}
+
+// Agent inventory: versions, serial numbers, revisions and live signals
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+    inv, err := s.cli.Discover(r.Context())
+    if err != nil { writeAgentError(w, err); return }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(inv)
 }
 
 func (s *Server) handleSessionStart(w http.ResponseWriter, r *http.Request) {
@@ -77,7 +106,9 @@ func (s *Server) handleSessionStart(w http.ResponseWriter, r *http.Request) {
     _ = json.NewDecoder(r.Body).Decode(&body)
     id := time.Now().Format("20060102_150405")
     dirs := s.sm.SessionDirs(id)
-    for _, d := range dirs { _ = meta.Write(d, meta.SessionMeta{SessionID: id, Doctor: body.Doctor, Hospital: body.Hospital, Patient: body.Patient, SurgeryType: body.SurgeryType}) }
+    m := meta.SessionMeta{SessionID: id, Doctor: body.Doctor, Hospital: body.Hospital, Patient: body.Patient, SurgeryType: body.SurgeryType}
+    if inv, err := s.cli.Discover(r.Context()); err == nil { m.Devices = &inv } else { log.Println("session devices:", err) }
+    for _, d := range dirs { _ = meta.Write(d, m) }
     s.sessionID = id
     s.sessionDirs = dirs
     s.st.Set(state.SESSION_ACTIVE)
@@ -94,26 +125,44 @@ func (s *Server) handleSessionStart(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleRecordStart(w http.ResponseWriter, r *http.Request) {
     if s.stopping { w.WriteHeader(http.StatusConflict); return }
+    if s.st.Get() == state.UPDATING { w.Header().Set("Retry-After", "5"); w.WriteHeader(http.StatusServiceUnavailable); w.Write([]byte("agent updating")); return }
     if s.st.Get() != state.SESSION_ACTIVE && s.st.Get() != state.READY { w.WriteHeader(http.StatusConflict); return }
     if s.sessionID == "" { w.WriteHeader(http.StatusConflict); w.Write([]byte("no active session")); return }
     dirs := s.sessionDirs
     outs := []string{}
     for _, d := range dirs { outs = append(outs, filepath.Join(d, "video")) }
     jobs, err := s.rec.Start(outs, "video/mp4")
-    if err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
+    if err != nil { writeAgentError(w, err); return }
+    if s.cfg.AudioNotes {
+        // Notes are a separate track: the video records without them
+        audio := []string{}
+        for _, d := range dirs { audio = append(audio, filepath.Join(d, "audio")) }
+        if err := s.rec.StartAudio(audio, time.Duration(s.cfg.AudioSplitMin)*time.Minute); err != nil {
+            log.Printf("audio notes: %v", err)
+            s.ev.Broadcast("audio_notes_failed", map[string]interface{}{"error": err.Error()})
+        }
+    }
     s.rec.OnUpdate(func(sts []recording.JobStatus){
-        active := 0; failed := 0
-        for _, sjs := range sts { if sjs.Status == "ACTIVE" || sjs.Status == "recording" { active++ } ; if sjs.Status == "FAILED" { failed++ } }
+        // Agent worker status: running, paused, break (file split) or completed
+        if s.st.Get() == state.UPDATING { return } // Restored once the agent is back
+        active := 0; paused := 0; failed := 0
+        for _, sjs := range sts {
+            switch sjs.Status {
+            case "running", "break": active++
+            case "paused": paused++
+            case "FAILED": failed++
+            }
+        }
         if failed > 0 {
             s.st.Set(state.DEGRADED)
             s.ov.DriveWarning("Drive failure; recording continues", 2000)
             s.ev.Broadcast("drive_failure", map[string]interface{}{"failed": failed})
             for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("drive_failure", map[string]any{"failed": failed})) }
-        } else if active == 0 {
+        } else if active == 0 && paused == 0 {
             s.st.Set(state.ERROR_BLOCKING)
             s.ev.Broadcast("recording_blocked", map[string]interface{}{})
             for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("recording_blocked", map[string]any{})) }
-        } else {
+        } else if s.st.Get() != state.PAUSED {
             s.st.Set(state.RECORDING)
         }
     })
@@ -127,7 +176,7 @@ func (s *Server) handleRecordStart(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleRecordPause(w http.ResponseWriter, r *http.Request) {
     if s.stopping { w.WriteHeader(http.StatusConflict); return }
     if s.st.Get() != state.RECORDING { w.WriteHeader(http.StatusConflict); return }
-    if err := s.rec.Pause(); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
+    if err := s.rec.Pause(); err != nil { writeAgentError(w, err); return }
     s.st.Set(state.PAUSED)
     s.ov.SetRecordingIndicator(true, true)
     s.ev.Broadcast("recording_state", map[string]interface{}{"recording": true, "paused": true})
@@ -138,7 +187,7 @@ func (s *Server) handleRecordPause(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleRecordResume(w http.ResponseWriter, r *http.Request) {
     if s.stopping { w.WriteHeader(http.StatusConflict); return }
     if s.st.Get() != state.PAUSED { w.WriteHeader(http.StatusConflict); return }
-    if err := s.rec.Resume(); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
+    if err := s.rec.Resume(); err != nil { writeAgentError(w, err); return }
     s.st.Set(state.RECORDING)
     s.ov.SetRecordingIndicator(true, false)
     s.ev.Broadcast("recording_state", map[string]interface{}{"recording": true, "paused": false})
@@ -149,7 +198,7 @@ func (s *Server) handleRecordResume(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleRecordStop(w http.ResponseWriter, r *http.Request) {
     s.stopping = true
     results, err := s.rec.Stop()
-    if err != nil { s.stopping = false; w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
+    if err != nil { s.stopping = false; writeAgentError(w, err); return }
     s.st.Set(state.SESSION_ACTIVE)
     s.ov.SetRecordingIndicator(false, false)
     s.ev.Broadcast("recording_state", map[string]interface{}{"recording": false, "paused": false})
@@ -167,60 +216,93 @@ func (s *Server) handlePhotoCapture(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(map[string]any{"status": "ok"})
 }
 
+// One-push white balance: the target at the center of the image, eg gauze,
+// is checked, balanced and verified on a new frame. Target failures answer
+// 422 with their reason.
 func (s *Server) handleWhiteBalance(w http.ResponseWriter, r *http.Request) {
-    wb := lt.CameraWhite{Temperature: 6500}
-    if err := s.cli.SetWhite(wb); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
-    s.ev.Broadcast("white_balance", map[string]interface{}{"complete": true})
+    s.ev.Broadcast("white_balance", map[string]interface{}{"complete": false, "running": true})
+    res, err := s.cli.WhiteBalance(r.Context())
+    if err != nil {
+        data := map[string]any{"complete": false, "error": err.Error()}
+        s.ev.Broadcast("white_balance", data)
+        s.ov.Toast("White balance failed: "+err.Error(), 3000)
+        for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("white_balance", data)) }
+        var f whitebalance.Failure
+        if !errors.As(err, &f) { writeAgentError(w, err); return }
+        w.WriteHeader(http.StatusUnprocessableEntity)
+        json.NewEncoder(w).Encode(map[string]any{"status": "failed", "error": f.Error()})
+        return
+    }
+    data := map[string]any{"complete": true, "balance": res.Balance, "previous": res.Previous, "iterations": res.Iterations}
+    s.ev.Broadcast("white_balance", data)
     s.ov.Toast("White balance complete", 2000)
-    for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("white_balance", map[string]any{"complete": true})) }
-    json.NewEncoder(w).Encode(map[string]any{"status": "ok"})
+    for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("white_balance", data)) }
+    json.NewEncoder(w).Encode(map[string]any{"status": "ok", "balance": res.Balance, "iterations": res.Iterations})
 }
 
 func (s *Server) handleSetColors(w http.ResponseWriter, r *http.Request) {
-    var v lt.CameraColors
-    _ = json.NewDecoder(r.Body).Decode(&v)
-    s.lim.Colors(v)
+    var v lt.JSON
+    if err := json.NewDecoder(r.Body).Decode(&v); err != nil { w.WriteHeader(http.StatusBadRequest); w.Write([]byte(err.Error())); return }
+    if err := s.lim.Colors(v); err != nil { w.WriteHeader(http.StatusBadRequest); w.Write([]byte(err.Error())); return }
     s.ov.Slider("Colors", "pending", 800)
     s.ev.Broadcast("parameter_change", map[string]interface{}{"parameter": "colors", "value": v})
     json.NewEncoder(w).Encode(map[string]any{"status": "ok"})
 }
 
 func (s *Server) handleSetVisuals(w http.ResponseWriter, r *http.Request) {
-    var v lt.CameraVisuals
-    _ = json.NewDecoder(r.Body).Decode(&v)
-    s.lim.Visuals(v)
+    var v lt.JSON
+    if err := json.NewDecoder(r.Body).Decode(&v); err != nil { w.WriteHeader(http.StatusBadRequest); w.Write([]byte(err.Error())); return }
+    if err := s.lim.Visuals(v); err != nil { w.WriteHeader(http.StatusBadRequest); w.Write([]byte(err.Error())); return }
     s.ov.Slider("Visuals", "pending", 800)
     s.ev.Broadcast("parameter_change", map[string]interface{}{"parameter": "visuals", "value": v})
     json.NewEncoder(w).Encode(map[string]any{"status": "ok"})
 }
 
+// Presets patch only the fields they set, other camera settings are kept
+type preset struct{ colors, visuals, white lt.JSON }
+
+var presets = map[string]preset{
+    "arthroscopy": {
+        colors: lt.JSON{"brightness": 10, "contrast": 15, "saturation": 5, "hue": 0},
+        visuals: lt.JSON{"zoom": 1.0, "sharpness": 0.7},
+        white: lt.JSON{"temperature": 6500},
+    },
+    "red_boost": {
+        colors: lt.JSON{"brightness": 20, "contrast": 25, "saturation": 15, "hue": -5},
+        visuals: lt.JSON{"zoom": 1.0, "sharpness": 0.8},
+        white: lt.JSON{"temperature": 5800},
+    },
+}
+
 func (s *Server) handlePresetApply(w http.ResponseWriter, r *http.Request) {
     var req struct{ Preset string `json:"preset"` }
     _ = json.NewDecoder(r.Body).Decode(&req)
-    switch req.Preset {
-    case "arthroscopy":
-        colors := lt.CameraColors{Brightness: 10, Contrast: 15, Saturation: 5, Hue: 0}
-        visuals := lt.CameraVisuals{Zoom: 1.0, Sharpness: 0.7}
-        white := lt.CameraWhite{Temperature: 6500}
-        if err := s.cli.SetColors(colors); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
-        if err := s.cli.SetVisuals(visuals); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
-        if err := s.cli.SetWhite(white); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
-    case "red_boost":
-        colors := lt.CameraColors{Brightness: 20, Contrast: 25, Saturation: 15, Hue: -5}
-        visuals := lt.CameraVisuals{Zoom: 1.0, Sharpness: 0.8}
-        white := lt.CameraWhite{Temperature: 5800}
-        if err := s.cli.SetColors(colors); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
-        if err := s.cli.SetVisuals(visuals); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
-        if err := s.cli.SetWhite(white); err != nil { w.WriteHeader(http.StatusBadGateway); w.Write([]byte(err.Error())); return }
-    default:
-        w.WriteHeader(http.StatusBadRequest); w.Write([]byte("unknown preset")); return
-    }
+    if _, ok := presets[req.Preset]; !ok { w.WriteHeader(http.StatusBadRequest); w.Write([]byte("unknown preset")); return }
+    changes, err := s.applyPreset(req.Preset)
+    if err != nil { writeAgentError(w, err); return }
+    s.curPreset = req.Preset
     s.ov.Toast("Preset applied: "+req.Preset, 1500)
-    s.ev.Broadcast("preset_applied", map[string]interface{}{"preset": req.Preset})
-    for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("preset_applied", map[string]any{"preset": req.Preset})) }
+    s.ev.Broadcast("preset_applied", map[string]interface{}{"preset": req.Preset, "changes": changes})
+    for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("preset_applied", map[string]any{"preset": req.Preset, "changes": changes})) }
     json.NewEncoder(w).Encode(map[string]any{"status": "applied", "preset": req.Preset})
 }
 
+// Patch the camera settings of a preset
+func (s *Server) applyPreset(name string) ([]lt.Change, error) {
+    preset := presets[name]
+    var changes []lt.Change
+    for _, patch := range []func() ([]lt.Change, error){
+        func() ([]lt.Change, error) { return s.cli.PatchColors(preset.colors) },
+        func() ([]lt.Change, error) { return s.cli.PatchVisuals(preset.visuals) },
+        func() ([]lt.Change, error) { return s.cli.PatchWhite(preset.white) },
+    } {
+        c, err := patch()
+        if err != nil { return changes, err }
+        changes = append(changes, c...)
+    }
+    return changes, nil
+}
+
 func (s *Server) handleControllerEvent(w http.ResponseWriter, r *http.Request) {
     var req struct{ DeviceId string `json:"deviceId"`; Btn int `json:"btn"`; Press string `json:"press"` }
     _ = json.NewDecoder(r.Body).Decode(&req)
@@ -240,15 +322,36 @@ func (s *Server) handleControllerEvent(w http.ResponseWriter, r *http.Request) {
         b, _ := json.Marshal(map[string]string{"preset": next})
         req2 := &http.Request{Method: "POST", Body: io.NopCloser(bytes.NewReader(b))}
         s.handlePresetApply(w, req2)
-        s.curPreset = next
         return
     case 4:
-        var v lt.CameraVisuals
-        v.Zoom = 1.1
-        _ = s.cli.SetVisuals(v)
+        changes, err := s.cli.PatchVisuals(lt.JSON{"zoom": 1.1})
+        if err != nil { writeAgentError(w, err); return }
         s.ov.Slider("Zoom", "1.1x", 1000)
+        s.ev.Broadcast("parameter_change", map[string]interface{}{"parameter": "visuals", "changes": changes})
         json.NewEncoder(w).Encode(map[string]any{"status": "zoom"})
         return
     }
     w.WriteHeader(http.StatusBadRequest)
 }
+
+// Agent failures map to the HTTP status of their kind, not a blanket 502
+func agentStatus(err error) int {
+    switch lt.ErrorKindOf(err) {
+    case lt.KindNotFound: return http.StatusNotFound
+    case lt.KindInvalidArgument: return http.StatusBadRequest
+    case lt.KindBusy: return http.StatusConflict
+    case lt.KindUpdating: return http.StatusServiceUnavailable
+    case lt.KindUnsupported: return http.StatusNotImplemented
+    case lt.KindTransport:
+        if errors.Is(err, context.DeadlineExceeded) { return http.StatusGatewayTimeout }
+        return http.StatusBadGateway
+    default: return http.StatusBadGateway
+    }
+}
+
+func writeAgentError(w http.ResponseWriter, err error) {
+    status := agentStatus(err)
+    if status == http.StatusServiceUnavailable { w.Header().Set("Retry-After", "5") }
+    w.WriteHeader(status)
+    w.Write([]byte(err.Error()))
+}
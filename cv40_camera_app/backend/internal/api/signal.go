@@ -0,0 +1,75 @@
+package api
+
+import (
+    "context"
+    "fmt"
+    "log"
+    lt "lt/client/go"
+    "cv40-camera-backend/internal/meta"
+    "cv40-camera-backend/internal/state"
+    "cv40-camera-backend/internal/video"
+)
+
+func (s *Server) watchSignal(ctx context.Context) {
+    video.NewMonitor(s.cli, 0).Run(ctx, s.onSignal)
+}
+
+// Signal transitions are broadcast, logged into the session and shown on the
+// monitor. With signalLoss set, the recording is paused or split meanwhile.
+func (s *Server) onSignal(e video.Event) {
+    v := e.Current
+    data := map[string]any{"signal": v.Signal, "size": v.Size, "framerate": v.Framerate, "interlaced": v.Interlaced}
+    if e.Type == video.FormatChanged {
+        p := e.Previous
+        data["previous"] = map[string]any{"size": p.Size, "framerate": p.Framerate, "interlaced": p.Interlaced}
+    }
+    log.Println("video", e.Type, v.Signal, v.Size, v.Framerate)
+    s.ev.Broadcast(e.Type, data)
+    for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent(e.Type, data)) }
+
+    switch e.Type {
+    case video.SignalLost:
+        s.holdRecording()
+        s.ov.SignalWarning("NO VIDEO SIGNAL")
+    case video.SignalLocked:
+        s.ov.Toast("Video signal restored", 2000)
+        s.releaseRecording()
+    case video.FormatChanged:
+        s.ov.Toast(fmt.Sprintf("Video format %dx%d %s", v.Size[0], v.Size[1], rate(v)), 2000)
+        if s.cfg.SignalLoss == "split" && s.st.Get() == state.RECORDING {
+            s.holdRecording()
+            s.releaseRecording()
+        }
+    }
+}
+
+// Pause or stop the recording while the signal is lost
+func (s *Server) holdRecording() {
+    st := s.st.Get()
+    switch {
+    case s.cfg.SignalLoss == "pause" && st == state.RECORDING:
+        if w := s.invoke(s.handleRecordPause, nil); w.Code < 300 { s.signalHeld = "pause" }
+    case s.cfg.SignalLoss == "split" && (st == state.RECORDING || st == state.PAUSED):
+        if w := s.invoke(s.handleRecordStop, nil); w.Code < 300 { s.signalHeld = "split" }
+    }
+}
+
+// Resume, or record new files, once the signal is back
+func (s *Server) releaseRecording() {
+    held := s.signalHeld
+    s.signalHeld = ""
+    st := s.st.Get()
+    switch {
+    case held == "pause" && st == state.PAUSED:
+        if w := s.invoke(s.handleRecordResume, nil); w.Code >= 300 { log.Println("signal resume:", w.Code, w.Body.String()) }
+    case held == "split" && st == state.SESSION_ACTIVE:
+        if w := s.invoke(s.handleRecordStart, nil); w.Code >= 300 { log.Println("signal split:", w.Code, w.Body.String()) }
+    }
+}
+
+// Scan and rate, eg "p60" or "i50"
+func rate(v lt.VideoSignal) string {
+    scan := "p"
+    if v.Interlaced { scan = "i" }
+    return fmt.Sprintf("%s%g", scan, v.Framerate)
+}
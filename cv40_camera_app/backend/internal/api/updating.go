@@ -0,0 +1,77 @@
+package api
+
+import (
+    "context"
+    "errors"
+    "log"
+    "time"
+    lt "lt/client/go"
+    "cv40-camera-backend/internal/meta"
+    "cv40-camera-backend/internal/state"
+)
+
+// Agent status polls while it updates
+var updatePoll = 2 * time.Second
+
+// An agent answering "updating" is having its firmware or software updated,
+// every call fails until it is done. The service waits in UPDATING instead of
+// failing calls one by one.
+func (s *Server) watchUpdating(next lt.CallFunc) lt.CallFunc {
+    return func(ctx context.Context, method, url string, body, response any) error {
+        err := next(ctx, method, url, body, response)
+        if errors.Is(err, lt.ErrUpdating) { s.enterUpdating() }
+        return err
+    }
+}
+
+func (s *Server) enterUpdating() {
+    s.updMu.Lock()
+    defer s.updMu.Unlock()
+    if s.updating { return }
+    s.updating = true
+    prev := s.st.Get()
+    s.st.SetReason(state.UPDATING, "agent updating")
+    log.Println("agent updating, waiting")
+    data := map[string]any{"phase": "started", "previous": prev}
+    s.ev.Broadcast("agent_updating", data)
+    for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("agent_updating", data)) }
+    go s.waitUpdate(prev)
+}
+
+// Poll until the agent answers normally, then initialize the overlay and
+// apply the current preset again: an update resets both. The agent restart
+// ended the recording workers: a recording is reported stopped, the service
+// is SESSION_ACTIVE with a session open, READY otherwise.
+func (s *Server) waitUpdate(prev state.Status) {
+    start := time.Now()
+    s.ov.Notice("AGENT UPDATING - PLEASE WAIT")
+    for {
+        time.Sleep(updatePoll)
+        err := s.cli.Health()
+        if err == nil { err = s.ov.InitOutput() }
+        if err == nil && s.curPreset != "" { _, err = s.applyPreset(s.curPreset) }
+        if err == nil { break }
+        s.ev.Broadcast("agent_updating", map[string]interface{}{"phase": "waiting", "elapsedS": int(time.Since(start).Seconds()), "error": err.Error()})
+    }
+
+    next := state.READY
+    if s.sessionID != "" { next = state.SESSION_ACTIVE }
+    recording := prev == state.RECORDING || prev == state.PAUSED
+    if recording { s.rec.Reset(); s.signalHeld = "" }
+    s.updMu.Lock()
+    s.st.Set(next)
+    s.updating = false
+    s.updMu.Unlock()
+    if recording {
+        s.ov.SetRecordingIndicator(false, false)
+        s.ev.Broadcast("recording_state", map[string]interface{}{"recording": false, "paused": false, "reason": "agent_updated"})
+        for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("record_stop", map[string]any{"reason": "agent_updated"})) }
+    }
+
+    elapsed := time.Since(start).Round(time.Second)
+    log.Printf("agent update done after %v, %s", elapsed, next)
+    data := map[string]any{"phase": "complete", "elapsedS": int(elapsed.Seconds()), "state": next, "preset": s.curPreset, "recordingStopped": recording}
+    s.ev.Broadcast("agent_updating", data)
+    for _, d := range s.sessionDirs { _ = meta.AppendEvent(d, meta.NewEvent("agent_updating", data)) }
+    s.ov.Toast("Agent update complete", 2000)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    lt "lt/client/go"
+    "lt/client/go/lttest"
+    "cv40-camera-backend/internal/config"
+    "cv40-camera-backend/internal/cv40"
+    "cv40-camera-backend/internal/events"
+    "cv40-camera-backend/internal/overlay"
+    "cv40-camera-backend/internal/state"
+    "cv40-camera-backend/internal/storage"
+)
+
+// The boot health check of an updating agent goes through the server: the
+// service waits in UPDATING
+func TestBootUpdating(t *testing.T) {
+    srv := lttest.NewServer()
+    defer srv.Close()
+    srv.Fail("GET", "/0/camera/0", lt.ErrUpdating)
+    cfg := config.Config{BaseURL: srv.Agent()}
+    cli := cv40.NewRealClient(cfg)
+    defer cli.Close()
+    st := state.NewStore()
+    NewServer(cfg, cli, overlay.NewEngine(cli, cfg), storage.NewManager(cfg), st, events.NewHub())
+
+    if err := cli.Health(); !errors.Is(err, lt.ErrUpdating) { t.Fatalf("health: %v, want ErrUpdating", err) }
+    if st.Get() != state.UPDATING { t.Errorf("state %s, want UPDATING", st.Get()) }
+}
+
+// The agent restart of an update ends the recording workers: the recording
+// is reported stopped once the agent is back
+func TestUpdateEndsRecording(t *testing.T) {
+    updatePoll = 10 * time.Millisecond
+    srv := lttest.NewServer()
+    defer srv.Close()
+    cfg := config.Config{BaseURL: srv.Agent(), Overlay: config.OverlaySpec{Output: "hdmi-out/0"}}
+    cli := cv40.NewRealClient(cfg)
+    defer cli.Close()
+    st := state.NewStore()
+    s := NewServer(cfg, cli, overlay.NewEngine(cli, cfg), storage.NewManager(cfg), st, events.NewHub())
+
+    dir := t.TempDir()
+    os.MkdirAll(filepath.Join(dir, "logs"), 0o755)
+    s.sessionID, s.sessionDirs = "test", []string{dir}
+    if _, err := s.rec.Start([]string{filepath.Join(dir, "video")}, "video/mp4"); err != nil { t.Fatal(err) }
+    st.Set(state.RECORDING)
+
+    var camera any
+    if err := srv.Resource("/0/camera/0", &camera); err != nil { t.Fatal(err) }
+    srv.Fail("GET", "/0/camera/0", lt.ErrUpdating)
+    cli.Health()
+    if st.Get() != state.UPDATING { t.Fatalf("state %s, want UPDATING", st.Get()) }
+    srv.Handle("GET", "/0/camera/0", func(*lttest.Request) (any, error) { return camera, nil })
+
+    deadline := time.Now().Add(5 * time.Second)
+    for st.Get() == state.UPDATING && time.Now().Before(deadline) { time.Sleep(10 * time.Millisecond) }
+    if st.Get() != state.SESSION_ACTIVE { t.Errorf("state %s after the update, want SESSION_ACTIVE", st.Get()) }
+    var b []byte
+    for !strings.Contains(string(b), "record_stop") && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+        b, _ = os.ReadFile(filepath.Join(dir, "logs", "events.jsonl"))
+    }
+    if !strings.Contains(string(b), "record_stop") { t.Errorf("session events %s, want a record_stop", b) }
+}
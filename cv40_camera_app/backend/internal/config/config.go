@@ -3,7 +3,10 @@ package config
 import (
     "encoding/json"
     "errors"
+    "fmt"
     "os"
+    "strings"
+    lt "lt/client/go"
 )
 
 type RecordingDefaults struct {
@@ -39,6 +42,13 @@ type Config struct {
     Recording RecordingDefaults `json:"recording"`
     Ranges SafeRanges `json:"ranges"`
     Overlay OverlaySpec `json:"overlay"`
+    SlowAgentMs int `json:"slowAgentMs"` // Agent call duration flagged as slow, 500 by default
+    CameraButtons bool `json:"cameraButtons"` // Camera head buttons mapped like the ESP32 controller
+    SignalLoss string `json:"signalLoss"` // Recording on video signal loss: "" keeps it, "pause" or "split"
+    AudioNotes bool `json:"audioNotes"` // Camera audio input recorded to WAV files in audio/ alongside the video
+    AudioSplitMin int `json:"audioSplitMin"` // Audio notes file duration in minutes, 0 for one file per recording
+    PreviewSize [2]int `json:"previewSize"` // Live preview frame size, 640x360 by default
+    PreviewFps float64 `json:"previewFps"` // Live preview framerate cap, 10 by default
 }
 
 func Load(path string) (Config, error) {
@@ -53,5 +63,55 @@ func Load(path string) (Config, error) {
     if c.CameraID < 0 || c.BoardID < 0 {
         return c, errors.New("invalid board/camera id")
     }
+    switch c.SignalLoss {
+    case "", "pause", "split":
+    default:
+        return c, errors.New("invalid signalLoss: " + c.SignalLoss)
+    }
+    if c.AudioSplitMin < 0 {
+        return c, errors.New("invalid audioSplitMin")
+    }
+    if c.PreviewSize[0] < 0 || c.PreviewSize[1] < 0 || c.PreviewFps < 0 {
+        return c, errors.New("invalid previewSize/previewFps")
+    }
+    if c.SlowAgentMs <= 0 {
+        c.SlowAgentMs = 500
+    }
     return c, nil
 }
+
+// Features returns the agent features the configuration uses
+func (c Config) Features() []lt.Feature {
+    var fs []lt.Feature
+    for _, o := range []string{c.OutputID, c.Overlay.Output} {
+        if strings.HasPrefix(o, "sdi-out/") { fs = append(fs, lt.FeatureSDIOut); break }
+    }
+    if c.Ranges.LowLightGain[1] > 0 { fs = append(fs, lt.FeatureLowLight) }
+    return fs
+}
+
+// CheckFeatures returns why the agent cannot serve the configuration fully,
+// "" if it can
+func (c Config) CheckFeatures(caps lt.Capabilities) string {
+    missing := caps.Missing(c.Features()...)
+    if len(missing) == 0 { return "" }
+    names := []string{}
+    for _, f := range missing { names = append(names, string(f)) }
+    return fmt.Sprintf("agent version %s lacks %s", caps.Version, strings.Join(names, ", "))
+}
+
+// CheckDevices verifies the board, camera and outputs exist on the agent
+func (c Config) CheckDevices(inv lt.Inventory) error {
+    b, ok := inv.Board(c.BoardID)
+    if !ok { return fmt.Errorf("board %d not found, the agent has %d", c.BoardID, len(inv.Boards)) }
+    if _, ok := b.Camera(c.CameraID); !ok { return fmt.Errorf("camera %d not found on board %d, it has %d", c.CameraID, c.BoardID, len(b.Cameras)) }
+    for _, o := range []string{c.OutputID, c.Overlay.Output} {
+        if o == "" { continue }
+        if _, ok := b.Output(o); !ok {
+            names := []string{}
+            for _, bo := range b.Outputs { names = append(names, bo.Name) }
+            return fmt.Errorf("output %q not found on board %d, outputs: %s", o, c.BoardID, strings.Join(names, ", "))
+        }
+    }
+    return nil
+}
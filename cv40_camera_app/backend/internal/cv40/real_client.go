@@ -1,76 +1,182 @@
 package cv40
 
 import (
+    "context"
     "errors"
-    "strconv"
+    "image"
+    "io"
+    "log"
     "time"
     lt "lt/client/go"
+    "lt/client/go/frame"
+    "lt/client/go/whitebalance"
     "cv40-camera-backend/internal/config"
 )
 
 type RealClient struct {
-    cfg config.Config
-    c   lt.Client
+    cfg   config.Config
+    c     *lt.Client
+    base  string
+    agent lt.AgentPath
+    board lt.BoardPath
+    cam   lt.CameraPath
+    lat   *lt.Latency
 }
 
+// Handlers, the recording poller and the limiter call concurrently, each
+// call takes its own pooled connection to the agent. Workers long polls hold
+// the connection which created them, eg the preview and audio notes ones.
 func NewRealClient(cfg config.Config) *RealClient {
-    return &RealClient{cfg: cfg}
+    base := cfg.BaseURL
+    if base == "" { base = "cv40" }
+    return newRealClient(cfg, base, lt.NewPooledClient(lt.PoolConfig{MaxConns: 6}))
+}
+
+// NewReplayClient answers from an lt capture instead of the agent, so a field
+// trace drives the recording manager and overlay engine offline.
+func NewReplayClient(cfg config.Config, capture io.Reader, realtime bool) (*RealClient, error) {
+    c, err := lt.NewReplayClient(capture, lt.ReplayConfig{Realtime: realtime})
+    if err != nil { return nil, err }
+    base := cfg.BaseURL
+    if base == "" { base = "cv40" }
+    return newRealClient(cfg, base, c), nil
+}
+
+func newRealClient(cfg config.Config, base string, c *lt.Client) *RealClient {
+    agent := lt.At(base)
+    board := agent.Board(cfg.BoardID)
+    r := &RealClient{cfg: cfg, c: c, base: base, agent: agent, board: board, cam: board.Camera(cfg.CameraID), lat: lt.NewLatency()}
+    c.Use(lt.LogCalls(nil), r.lat.Interceptor())
+    return r
 }
 
 func (r *RealClient) Close() { r.c.Close() }
 
+// Record captures every agent call to w as JSONL, nil stops recording
+func (r *RealClient) Record(w io.Writer) { r.c.Record(w) }
+
+// Use adds interceptors around every agent call, inside logging and latency
+func (r *RealClient) Use(interceptors ...lt.Interceptor) { r.c.Use(interceptors...) }
+
+// Latency returns the agent call latency histograms
+func (r *RealClient) Latency() []lt.Histogram { return r.lat.Histograms() }
+
+// WatchButtons sends the camera head button events until ctx is done
+func (r *RealClient) WatchButtons(ctx context.Context, opts lt.ButtonOptions) (<-chan lt.ButtonEvent, error) {
+    opts.Client = r.c
+    return lt.WatchButtons(ctx, r.cam.Buttons().URL(), opts)
+}
+
+// OnConnEvent reports agent connection losses and reconnections
+func (r *RealClient) OnConnEvent(fn func(lt.ConnEvent)) { r.c.OnConnEvent(fn) }
+
 func (r *RealClient) Health() error {
-    var cam lt.Camera
-    r.c.Timeout = 1500 * time.Millisecond
-    return r.c.Get("cv40:/0/camera/0", &cam)
+    ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+    defer cancel()
+    _, err := r.cam.GetContext(ctx, r.c)
+    return err
 }
 
-func (r *RealClient) CreateVideoWorker(dest string, media string) (string, error) {
-    err := r.c.Post("cv40:/0/camera/0/file", lt.VideoFileWorker{Media: media, Location: dest}, nil)
-    if !errors.Is(err, lt.ErrRedirect) { return "", err }
-    return lt.RedirectLocation(err), nil
+// Discover returns the inventory of the agent boards, cameras and outputs
+func (r *RealClient) Discover(ctx context.Context) (lt.Inventory, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+    return lt.Discover(ctx, r.c, r.base)
 }
 
-func (r *RealClient) StartWorker(u string) error { return r.c.Post(u+"/start", nil, nil) }
-func (r *RealClient) PauseWorker(u string) error { return r.c.Post(u+"/pause", nil, nil) }
-func (r *RealClient) StopWorker(u string) error { return r.c.Post(u+"/stop", nil, nil) }
+// Capabilities returns the agent version and features, fetched once per
+// connection
+func (r *RealClient) Capabilities(ctx context.Context) (lt.Capabilities, error) {
+    ctx, cancel := context.WithTimeout(ctx, 1500*time.Millisecond)
+    defer cancel()
+    return r.c.Capabilities(ctx, r.base)
+}
 
+// Camera returns the configured camera, with its video and audio signals
+func (r *RealClient) Camera(ctx context.Context) (lt.Camera, error) {
+    ctx, cancel := context.WithTimeout(ctx, 1500*time.Millisecond)
+    defer cancel()
+    return r.cam.GetContext(ctx, r.c)
+}
+
+func (r *RealClient) CreateVideoWorker(dest string, media string) (*lt.WorkerHandle, error) {
+    return lt.CreateFileWorker(context.Background(), r.c, r.cam.URL(), lt.VideoFileWorker{Media: media, Location: dest})
+}
+
+// CreatePreviewWorker streams raw camera frames scaled to size, at most fps per second
+func (r *RealClient) CreatePreviewWorker(ctx context.Context, size [2]int, fps float64) (*lt.WorkerHandle, error) {
+    return lt.CreateDataWorker(ctx, r.c, r.cam.URL(), lt.VideoDataWorker{Media: "video/yuv422", Size: size, Framerate: fps})
+}
+
+// GrabFrame returns one frame of the camera through a data worker, eg
+// "image/yuv422" decoded to a *image.YCbCr
+func (r *RealClient) GrabFrame(ctx context.Context, media string) (image.Image, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+    h, err := lt.CreateDataWorker(ctx, r.c, r.cam.URL(), lt.ImageDataWorker{Media: media})
+    if err != nil { return nil, err }
+    defer discard(ctx, h)
+    for p, err := range h.Packets(ctx) {
+        if err != nil { return nil, err }
+        img, err := frame.Decode(p)
+        p.Close()
+        return img, err
+    }
+    return nil, errors.New("cv40: data worker completed without a frame")
+}
+
+// Stop a worker left after its first packets, whatever ctx, so it does not
+// hold an agent worker and a pooled connection
+func discard(ctx context.Context, h *lt.WorkerHandle) {
+    ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+    defer cancel()
+    if err := h.Discard(ctx); err != nil { log.Printf("worker %s: %v", h.URL, err) }
+}
+
+// WhiteBalance balances the camera on the white target at the center of the image
+func (r *RealClient) WhiteBalance(ctx context.Context) (whitebalance.Result, error) {
+    return whitebalance.Run(ctx, r.c, r.cam.URL(), whitebalance.Options{})
+}
+
+// CreateAudioWorker serves the camera audio input packets, eg "audio/pcm"
+func (r *RealClient) CreateAudioWorker(media string) (*lt.WorkerHandle, error) {
+    return lt.CreateDataWorker(context.Background(), r.c, r.cam.URL(), lt.AudioDataWorker{Media: media})
+}
+
+// CaptureStill writes a jpeg in dest. The worker ends once the file is
+// written, waiting for it frees the connection owning it.
 func (r *RealClient) CaptureStill(dest string) error {
-    err := r.c.Post("cv40:/0/camera/0/file", lt.ImageFileWorker{Media: "image/jpeg", Location: dest}, nil)
-    if !errors.Is(err, lt.ErrRedirect) { return err }
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    h, err := lt.CreateFileWorker(ctx, r.c, r.cam.URL(), lt.ImageFileWorker{Media: "image/jpeg", Location: dest})
+    if err != nil { return err }
+    if _, err := h.Wait(ctx); err != nil { discard(ctx, h); return err }
     return nil
 }
 
-func (r *RealClient) SetColors(v lt.CameraColors) error { return r.c.Post("cv40:/0/camera/0/colors", &v, nil) }
-func (r *RealClient) SetVisuals(v lt.CameraVisuals) error { return r.c.Post("cv40:/0/camera/0/visuals", &v, nil) }
-func (r *RealClient) SetWhite(v lt.CameraWhite) error { return r.c.Post("cv40:/0/camera/0/white", &v, nil) }
-func (r *RealClient) SetExposure(v lt.CameraExposure) error { return r.c.Post("cv40:/0/camera/0/exposure", &v, nil) }
+// Settings are patched: fields missing from p keep their current value
+func (r *RealClient) PatchColors(p lt.JSON) ([]lt.Change, error) { _, c, err := r.cam.Colors().Patch(r.c, p); return c, err }
+func (r *RealClient) PatchVisuals(p lt.JSON) ([]lt.Change, error) { _, c, err := r.cam.Visuals().Patch(r.c, p); return c, err }
+func (r *RealClient) PatchWhite(p lt.JSON) ([]lt.Change, error) { _, c, err := r.cam.White().Patch(r.c, p); return c, err }
+func (r *RealClient) PatchExposure(p lt.JSON) ([]lt.Change, error) { _, c, err := r.cam.Exposure().Patch(r.c, p); return c, err }
 
-func (r *RealClient) GetColors() (lt.CameraColors, error) { var v lt.CameraColors; err := r.c.Get("cv40:/0/camera/0/colors", &v); return v, err }
-func (r *RealClient) GetVisuals() (lt.CameraVisuals, error) { var v lt.CameraVisuals; err := r.c.Get("cv40:/0/camera/0/visuals", &v); return v, err }
-func (r *RealClient) GetWhite() (lt.CameraWhite, error) { var v lt.CameraWhite; err := r.c.Get("cv40:/0/camera/0/white", &v); return v, err }
-func (r *RealClient) GetExposure() (lt.CameraExposure, error) { var v lt.CameraExposure; err := r.c.Get("cv40:/0/camera/0/exposure", &v); return v, err }
+func (r *RealClient) GetColors() (lt.CameraColors, error) { return r.cam.Colors().Get(r.c) }
+func (r *RealClient) GetVisuals() (lt.CameraVisuals, error) { return r.cam.Visuals().Get(r.c) }
+func (r *RealClient) GetWhite() (lt.CameraWhite, error) { return r.cam.White().Get(r.c) }
+func (r *RealClient) GetExposure() (lt.CameraExposure, error) { return r.cam.Exposure().Get(r.c) }
 
 func (r *RealClient) ConfigureOutputOverlay(output string, canvasID int) error {
-    return r.c.Post("cv40:/0/"+output, lt.JSON{"overlay": "canvas/"+strconv.Itoa(canvasID)}, nil)
+    return r.c.Post(r.board.Output(output).URL(), lt.JSON{"overlay": r.agent.Canvas(canvasID).Source()}, nil)
 }
 
 func (r *RealClient) CanvasInit(id int, size [2]int) error {
-    return r.c.Post("cv40:/canvas/"+strconv.Itoa(id)+"/init", lt.CanvasInit{Size: size}, nil)
+    return r.agent.Canvas(id).Init().Post(r.c, lt.CanvasInit{Size: size})
 }
 
 func (r *RealClient) CanvasText(id int, t lt.CanvasText) error {
-    return r.c.Post("cv40:/canvas/"+strconv.Itoa(id)+"/text", t, nil)
+    return r.agent.Canvas(id).Text().Post(r.c, t)
 }
 
 func (r *RealClient) GetOutput(output string) (lt.Output, error) {
-    var out lt.Output
-    err := r.c.Get("cv40:/0/"+output, &out)
-    return out, err
-}
-
-func (r *RealClient) GetWorker(u string) (lt.Worker, error) {
-    var w lt.Worker
-    err := r.c.Get(u, &w)
-    return w, err
+    return r.board.Output(output).Get(r.c)
 }
@@ -0,0 +1,64 @@
+package cv40
+
+import (
+    "context"
+    "errors"
+    "image"
+    "testing"
+    "time"
+    lt "lt/client/go"
+    "lt/client/go/lttest"
+    "cv40-camera-backend/internal/config"
+)
+
+// Client of a fake agent, closed with the test
+func newTestClient(t *testing.T) (*RealClient, *lttest.Server) {
+    srv := lttest.NewServer()
+    r := newRealClient(config.Config{}, srv.Agent(), lt.NewPooledClient(lt.PoolConfig{MaxConns: 6}))
+    t.Cleanup(func() { r.Close(); srv.Close() })
+    return r, srv
+}
+
+func TestHealth(t *testing.T) {
+    r, srv := newTestClient(t)
+    if err := r.Health(); err != nil { t.Fatal(err) }
+    srv.Fail("GET", "/0/camera/0", lt.ErrUpdating)
+    if err := r.Health(); !errors.Is(err, lt.ErrUpdating) { t.Errorf("health of an updating agent: %v, want ErrUpdating", err) }
+}
+
+func TestPatchColors(t *testing.T) {
+    r, srv := newTestClient(t)
+    changes, err := r.PatchColors(lt.JSON{"brightness": 10, "gamma": 1})
+    if err != nil { t.Fatal(err) }
+    if len(changes) != 1 || changes[0].Field != "brightness" { t.Errorf("changes %+v, want brightness only", changes) }
+    var colors lt.CameraColors
+    if err := srv.Resource("/0/camera/0/colors", &colors); err != nil { t.Fatal(err) }
+    if colors.Brightness != 10 || colors.Gamma != 1 { t.Errorf("agent colors %+v, want brightness 10 and gamma 1", colors) }
+}
+
+func TestGrabFrame(t *testing.T) {
+    r, srv := newTestClient(t)
+    srv.OnWorker(func(w *lttest.Worker) {
+        w.Push(lttest.Packet{Data: make([]byte, 4*2*2), Meta: lt.ImageMetadata{Size: [2]int{4, 2}}})
+    })
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    img, err := r.GrabFrame(ctx, "image/yuv422")
+    if err != nil { t.Fatal(err) }
+    if img.Bounds() != image.Rect(0, 0, 4, 2) { t.Errorf("frame bounds %v, want 4x2", img.Bounds()) }
+    // The worker ends with the grab
+    for _, w := range srv.Workers() { if w.Status() != "completed" { t.Errorf("worker %s %s after the grab, want completed", w.Path, w.Status()) } }
+}
+
+func TestCaptureStill(t *testing.T) {
+    r, srv := newTestClient(t)
+    srv.OnWorker(func(w *lttest.Worker) { w.SetName("still.jpg"); w.Push(lttest.Packet{Data: make([]byte, 10)}); w.End() })
+    for i := 0; i < 20; i++ {
+        if err := r.CaptureStill("/data/photos"); err != nil { t.Fatal(err) }
+        if err := r.Health(); err != nil { t.Fatal(err) }
+    }
+    // Captured workers do not hold their connection
+    conns := map[int]bool{}
+    for _, req := range srv.Requests() { conns[req.Client] = true }
+    if len(conns) > 6 { t.Errorf("captures used %d connections, want at most 6", len(conns)) }
+}
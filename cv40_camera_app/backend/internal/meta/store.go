@@ -4,6 +4,7 @@ import (
     "encoding/json"
     "os"
     "path/filepath"
+    lt "lt/client/go"
 )
 
 type SessionMeta struct {
@@ -12,6 +13,7 @@ type SessionMeta struct {
     Hospital string `json:"hospital"`
     Patient string `json:"patient"`
     SurgeryType string `json:"surgeryType"`
+    Devices *lt.Inventory `json:"devices,omitempty"` // Agent inventory at session start
 }
 
 func Write(dir string, m SessionMeta) error {
@@ -42,3 +42,11 @@ func (e *Engine) Slider(name string, value string, ms int) {
 func (e *Engine) DriveWarning(text string, ms int) {
     _ = e.cli.CanvasText(e.cfg.Overlay.CanvasID, lt.CanvasText{Text: text, FontSize: 34, Color: [4]int{255,255,0,255}, Size: [2]int{1920,1080}})
 }
+
+func (e *Engine) SignalWarning(text string) {
+    _ = e.cli.CanvasText(e.cfg.Overlay.CanvasID, lt.CanvasText{Text: text, FontSize: 72, Color: [4]int{255,0,0,255}, Size: [2]int{1920,1080}})
+}
+
+func (e *Engine) Notice(text string) {
+    _ = e.cli.CanvasText(e.cfg.Overlay.CanvasID, lt.CanvasText{Text: text, FontSize: 64, Color: [4]int{255,200,0,255}, Size: [2]int{1920,1080}})
+}
@@ -0,0 +1,176 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"image/jpeg"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"cv40-camera-backend/internal/cv40"
+	"lt/client/go/frame"
+)
+
+// Hub shares one low resolution data worker between the MJPEG viewers: the
+// worker starts with the first viewer and stops once the last one leaves.
+// Each frame is encoded once, viewers too slow for the framerate skip frames.
+type Hub struct {
+	cli     *cv40.RealClient
+	size    [2]int
+	fps     float64
+	quality int
+
+	mu      sync.Mutex
+	viewers map[chan []byte]struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func NewHub(cli *cv40.RealClient, size [2]int, fps float64) *Hub {
+	if size == [2]int{} {
+		size = [2]int{640, 360}
+	}
+	if fps <= 0 {
+		fps = 10
+	}
+	return &Hub{cli: cli, size: size, fps: fps, quality: 70, viewers: map[chan []byte]struct{}{}}
+}
+
+// Viewers returns the number of connected viewers
+func (h *Hub) Viewers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.viewers)
+}
+
+// Subscribe returns a channel of JPEG frames, and the function leaving
+func (h *Hub) Subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, 1)
+	h.mu.Lock()
+	h.viewers[ch] = struct{}{}
+	if h.cancel == nil {
+		// The previous worker may still be stopping
+		prev := h.done
+		ctx, cancel := context.WithCancel(context.Background())
+		h.cancel, h.done = cancel, make(chan struct{})
+		go h.run(ctx, prev, h.done)
+	}
+	h.mu.Unlock()
+	var once sync.Once
+	return ch, func() { once.Do(func() { h.leave(ch) }) }
+}
+
+func (h *Hub) leave(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.viewers, ch)
+	if len(h.viewers) == 0 && h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+}
+
+// Latest frame to every viewer, replacing the one it has not read yet
+func (h *Hub) broadcast(jpg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.viewers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- jpg
+	}
+}
+
+// Worker loop, recreating the worker after errors, eg a lost signal
+func (h *Hub) run(ctx context.Context, prev <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	if prev != nil {
+		<-prev
+	}
+	for ctx.Err() == nil {
+		if err := h.stream(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("preview: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (h *Hub) stream(ctx context.Context) error {
+	w, err := h.cli.CreatePreviewWorker(ctx, h.size, h.fps)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stop, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		w.Stop(stop)
+	}()
+	interval := time.Duration(float64(time.Second) / h.fps)
+	var last time.Time
+	var buf bytes.Buffer
+	for p, err := range w.Packets(ctx) {
+		if err != nil {
+			return err
+		}
+		if time.Since(last) < interval {
+			continue
+		}
+		img, err := frame.Decode(p)
+		if err != nil {
+			return err
+		}
+		last = time.Now()
+		buf.Reset()
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: h.quality}); err != nil {
+			return err
+		}
+		h.broadcast(bytes.Clone(buf.Bytes()))
+	}
+	return nil
+}
+
+// ServeHTTP streams the preview as multipart/x-mixed-replace JPEG frames
+// until the viewer disconnects
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	frames, leave := h.Subscribe()
+	defer leave()
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case jpg := <-frames:
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":   {"image/jpeg"},
+				"Content-Length": {strconv.Itoa(len(jpg))},
+			})
+			if err != nil {
+				return
+			}
+			if _, err := part.Write(jpg); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
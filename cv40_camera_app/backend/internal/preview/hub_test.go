@@ -0,0 +1,161 @@
+package preview
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"cv40-camera-backend/internal/config"
+	"cv40-camera-backend/internal/cv40"
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// Preview workers of a fake agent, pushing a 4x2 yuv422 frame every 10ms
+// until stopped. Stopping takes a while, like the agent releasing the sensor.
+type fakeCamera struct {
+	srv     *lttest.Server
+	mu      sync.Mutex
+	workers []*lttest.Worker
+	stopped map[string]bool
+	started chan bool // Whether the previous workers were stopped, per new worker
+}
+
+func (c *fakeCamera) add(w *lttest.Worker) {
+	c.mu.Lock()
+	stopped := true
+	for _, prev := range c.workers {
+		stopped = stopped && c.stopped[prev.Path]
+	}
+	c.workers = append(c.workers, w)
+	c.mu.Unlock()
+	c.started <- stopped
+
+	c.srv.Handle("POST", w.Path+"/stop", func(*lttest.Request) (any, error) {
+		time.Sleep(50 * time.Millisecond)
+		w.End()
+		c.mu.Lock()
+		c.stopped[w.Path] = true
+		c.mu.Unlock()
+		return nil, nil
+	})
+	go func() {
+		for w.Status() != "completed" {
+			w.Push(lttest.Packet{Data: make([]byte, 16), Meta: lt.ImageMetadata{Size: [2]int{4, 2}}})
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+}
+
+func (c *fakeCamera) Workers() []*lttest.Worker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.workers)
+}
+
+func newTestHub(t *testing.T) (*Hub, *fakeCamera) {
+	srv := lttest.NewServer()
+	cam := &fakeCamera{srv: srv, stopped: map[string]bool{}, started: make(chan bool, 10)}
+	srv.OnWorker(cam.add)
+	cli := cv40.NewRealClient(config.Config{BaseURL: srv.Agent()})
+	t.Cleanup(func() { cli.Close(); srv.Close() })
+	return NewHub(cli, [2]int{4, 2}, 100), cam
+}
+
+func receive(t *testing.T, frames <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case jpg := <-frames:
+		return jpg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no preview frame")
+		return nil
+	}
+}
+
+// Wait for the status of the worker
+func waitStatus(t *testing.T, w *lttest.Worker, status string) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); w.Status() != status; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("worker %s, want %s", w.Status(), status)
+		}
+	}
+}
+
+func TestHubLastViewerStops(t *testing.T) {
+	h, cam := newTestHub(t)
+	first, leaveFirst := h.Subscribe()
+	second, leaveSecond := h.Subscribe()
+	if jpg := receive(t, first); !bytes.HasPrefix(jpg, []byte{0xff, 0xd8}) {
+		t.Errorf("frame % x, want a jpeg", jpg[:min(len(jpg), 4)])
+	}
+	receive(t, second)
+
+	leaveFirst()
+	leaveFirst()
+	receive(t, second)
+	workers := cam.Workers()
+	if len(workers) != 1 || workers[0].Status() != "running" {
+		t.Fatalf("%d workers with one viewer left, want 1 running", len(workers))
+	}
+	leaveSecond()
+	waitStatus(t, workers[0], "completed")
+	if h.Viewers() != 0 {
+		t.Errorf("%d viewers, want 0", h.Viewers())
+	}
+}
+
+func TestHubRestartWaitsForWorker(t *testing.T) {
+	h, cam := newTestHub(t)
+	frames, leave := h.Subscribe()
+	receive(t, frames)
+	leave()
+	frames, leave = h.Subscribe()
+	defer leave()
+	receive(t, frames)
+
+	workers := cam.Workers()
+	if len(workers) != 2 {
+		t.Fatalf("%d workers, want 2", len(workers))
+	}
+	<-cam.started
+	if stopped := <-cam.started; !stopped {
+		t.Error("second worker created before the first one stopped")
+	}
+	if workers[1].Status() != "running" {
+		t.Errorf("second worker %s, want running", workers[1].Status())
+	}
+}
+
+func TestHubSlowViewer(t *testing.T) {
+	h, _ := newTestHub(t)
+	slow, leaveSlow := h.Subscribe()
+	defer leaveSlow()
+	fast, leaveFast := h.Subscribe()
+	defer leaveFast()
+
+	// The viewer not reading does not hold the others back
+	for range 5 {
+		receive(t, fast)
+	}
+	if len(slow) != 1 {
+		t.Errorf("%d frames queued for the slow viewer, want 1", len(slow))
+	}
+}
+
+func TestHubBroadcastLatest(t *testing.T) {
+	h := NewHub(nil, [2]int{4, 2}, 100)
+	ch := make(chan []byte, 1)
+	h.viewers[ch] = struct{}{}
+	h.broadcast([]byte("first"))
+	h.broadcast([]byte("second"))
+	if got := <-ch; string(got) != "second" {
+		t.Errorf("frame %q, want the latest", got)
+	}
+	if len(ch) != 0 {
+		t.Errorf("%d frames left, want 0", len(ch))
+	}
+}
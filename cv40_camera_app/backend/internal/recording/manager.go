@@ -1,19 +1,24 @@
 package recording
 
 import (
+    "context"
+    "log"
     "path/filepath"
     "time"
     "os"
+    lt "lt/client/go"
+    "lt/client/go/wav"
     "cv40-camera-backend/internal/cv40"
 )
 
-type Job struct { URL string; Target string }
+type Job struct { URL string; Target string; w *lt.WorkerHandle }
 
 type JobStatus struct { Job Job; Status string; Error string }
 
 type Manager struct {
     cli *cv40.RealClient
     jobs []Job
+    audio *audioJob
     pollStop chan struct{}
     onUpdate func([]JobStatus)
 }
@@ -23,15 +28,50 @@ func NewManager(cli *cv40.RealClient) *Manager { return &Manager{cli: cli} }
 func (m *Manager) Start(destDirs []string, media string) ([]Job, error) {
     m.jobs = nil
     for _, d := range destDirs {
-        u, err := m.cli.CreateVideoWorker(d, media)
+        w, err := m.cli.CreateVideoWorker(d, media)
         if err != nil { return nil, err }
-        if err := m.cli.StartWorker(u); err != nil { return nil, err }
-        m.jobs = append(m.jobs, Job{URL: u, Target: d})
+        if err := w.Start(context.Background()); err != nil { return nil, err }
+        m.jobs = append(m.jobs, Job{URL: w.URL, Target: d, w: w})
     }
     m.startPolling()
     return m.jobs, nil
 }
 
+// Audio notes: one data worker whose packets are written to every target
+type audioJob struct {
+    w      *lt.WorkerHandle
+    recs   []*wav.Recorder
+    cancel context.CancelFunc // Ends the packet loop
+    done   chan struct{}      // Closed once the loop ended and the files are closed
+}
+
+// StartAudio records the camera audio input to WAV files in each of dirs, a
+// new file every split (0 for one file), until Stop. A failing target does
+// not stop the others. Audio notes already recording are stopped first.
+func (m *Manager) StartAudio(dirs []string, split time.Duration) error {
+    m.stopAudio()
+    w, err := m.cli.CreateAudioWorker("audio/pcm")
+    if err != nil { return err }
+    ctx, cancel := context.WithCancel(context.Background())
+    a := &audioJob{w: w, cancel: cancel, done: make(chan struct{})}
+    name := "notes-" + time.Now().Format("20060102_150405")
+    for _, d := range dirs { a.recs = append(a.recs, wav.NewRecorder(wav.Options{Dir: d, Name: name, Split: split})) }
+    go func() {
+        defer close(a.done)
+        failed := make([]bool, len(a.recs))
+        for p, err := range w.Packets(ctx) {
+            if err != nil { log.Printf("audio notes: %v", err); break }
+            for i, r := range a.recs {
+                if failed[i] { continue }
+                if err := r.WritePacket(p); err != nil { failed[i] = true; log.Printf("audio notes %s: %v", dirs[i], err) }
+            }
+        }
+        for _, r := range a.recs { r.Close() }
+    }()
+    m.audio = a
+    return nil
+}
+
 func (m *Manager) startPolling() {
     if m.pollStop != nil { close(m.pollStop) }
     m.pollStop = make(chan struct{})
@@ -45,9 +85,9 @@ func (m *Manager) startPolling() {
             case <-ticker.C:
                 statuses := []JobStatus{}
                 for _, j := range m.jobs {
-                    w, err := m.cli.GetWorker(j.URL)
+                    status, err := j.w.Status(context.Background())
                     if err != nil { statuses = append(statuses, JobStatus{Job: j, Status: "FAILED", Error: err.Error()}); continue }
-                    statuses = append(statuses, JobStatus{Job: j, Status: w.Status})
+                    statuses = append(statuses, JobStatus{Job: j, Status: status})
                 }
                 if m.onUpdate != nil { m.onUpdate(statuses) }
             }
@@ -58,46 +98,62 @@ func (m *Manager) startPolling() {
 func (m *Manager) OnUpdate(fn func([]JobStatus)) { m.onUpdate = fn }
 
 func (m *Manager) Pause() error {
-    for _, j := range m.jobs { if err := m.cli.PauseWorker(j.URL); err != nil { return err } }
+    for _, j := range m.jobs { if err := j.w.Pause(context.Background()); err != nil { return err } }
+    if m.audio != nil { return m.audio.w.Pause(context.Background()) }
     return nil
 }
 
 func (m *Manager) Resume() error {
-    for _, j := range m.jobs { if err := m.cli.StartWorker(j.URL); err != nil { return err } }
+    for _, j := range m.jobs { if err := j.w.Start(context.Background()); err != nil { return err } }
+    if m.audio != nil { return m.audio.w.Start(context.Background()) }
     return nil
 }
 
-type RecordingResult struct { Target string; File string; Size int64 }
+type RecordingResult struct { Target string; File string; Size int64; Audio []string }
 
+// Stop the workers and wait up to 5s for their files to be finalized
 func (m *Manager) Stop() ([]RecordingResult, error) {
-    for _, j := range m.jobs { if err := m.cli.StopWorker(j.URL); err != nil { return nil, err } }
-    done := make(chan struct{})
-    go func() {
-        timeout := time.After(5 * time.Second)
-        for {
-            select {
-            case <-timeout:
-                close(done)
-                return
-            default:
-                allStopped := true
-                for _, j := range m.jobs {
-                    w, err := m.cli.GetWorker(j.URL)
-                    if err != nil { continue }
-                    if w.Status != "stopped" && w.Status != "finalized" { allStopped = false }
-                }
-                if allStopped { close(done); return }
-                time.Sleep(200 * time.Millisecond)
-            }
-        }
-    }()
-    <-done
+    for _, j := range m.jobs { if err := j.w.Stop(context.Background()); err != nil { return nil, err } }
+    if m.pollStop != nil { close(m.pollStop); m.pollStop = nil }
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    for _, j := range m.jobs { j.w.Wait(ctx) }
     results := m.verifyFiles()
-    if m.pollStop != nil { close(m.pollStop) }
+    for i, files := range m.stopAudio() { if i < len(results) { results[i].Audio = files } }
     m.jobs = nil
     return results, nil
 }
 
+// Stop the audio notes worker and wait up to 5s for its last packets, the
+// loop is ended otherwise. The WAV files are closed on return: it returns
+// the files of each target.
+func (m *Manager) stopAudio() [][]string {
+    a := m.audio
+    if a == nil { return nil }
+    m.audio = nil
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := a.w.Stop(ctx); err != nil { log.Printf("audio notes: %v", err) }
+    select {
+    case <-a.done:
+    case <-ctx.Done():
+        log.Printf("audio notes: worker did not end")
+    }
+    a.cancel()
+    <-a.done
+    files := [][]string{}
+    for _, r := range a.recs { files = append(files, r.Files()) }
+    return files
+}
+
+// Reset forgets a recording whose agent workers are gone, eg after an agent
+// restart: the status polling ends and the audio notes files are closed
+func (m *Manager) Reset() {
+    if m.pollStop != nil { close(m.pollStop); m.pollStop = nil }
+    if a := m.audio; a != nil { m.audio = nil; a.cancel(); <-a.done }
+    m.jobs = nil
+}
+
 func (m *Manager) verifyFiles() []RecordingResult {
     results := []RecordingResult{}
     for _, j := range m.jobs {
@@ -0,0 +1,76 @@
+package recording
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "testing"
+    lt "lt/client/go"
+    "lt/client/go/lttest"
+    "cv40-camera-backend/internal/config"
+    "cv40-camera-backend/internal/cv40"
+)
+
+// The fake agent writes no file, the test writes them in its place
+func TestStartStop(t *testing.T) {
+    srv := lttest.NewServer()
+    defer srv.Close()
+    cli := cv40.NewRealClient(config.Config{BaseURL: srv.Agent()})
+    defer cli.Close()
+    m := NewManager(cli)
+
+    dirs := []string{filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")}
+    jobs, err := m.Start(dirs, "video/mp4")
+    if err != nil { t.Fatal(err) }
+    workers := srv.Workers()
+    if len(jobs) != 2 || len(workers) != 2 { t.Fatalf("%d jobs and %d agent workers, want 2", len(jobs), len(workers)) }
+    for i, w := range workers {
+        var body struct{ Media, Location string }
+        json.Unmarshal(w.Body, &body)
+        if body.Media != "video/mp4" || body.Location != dirs[i] { t.Errorf("worker %d records %s to %s, want video/mp4 to %s", i, body.Media, body.Location, dirs[i]) }
+        if w.Status() != "running" { t.Errorf("worker %d %s, want running", i, w.Status()) }
+    }
+
+    if err := m.Pause(); err != nil { t.Fatal(err) }
+    for i, w := range workers { if w.Status() != "paused" { t.Errorf("worker %d %s, want paused", i, w.Status()) } }
+    if err := m.Resume(); err != nil { t.Fatal(err) }
+
+    for _, d := range dirs {
+        os.MkdirAll(d, 0o755)
+        os.WriteFile(filepath.Join(d, "rec.mp4"), make([]byte, 100), 0o644)
+    }
+    results, err := m.Stop()
+    if err != nil { t.Fatal(err) }
+    for i, w := range workers { if w.Status() != "completed" { t.Errorf("worker %d %s, want completed", i, w.Status()) } }
+    if len(results) != 2 { t.Fatalf("%d results, want 2", len(results)) }
+    for i, r := range results {
+        if r.File != filepath.Join(dirs[i], "rec.mp4") || r.Size != 100 { t.Errorf("result %d %s of %d bytes, want rec.mp4 of 100 bytes", i, r.File, r.Size) }
+    }
+}
+
+// Audio notes started again stop the previous ones, Stop closes the WAV files
+func TestAudioNotes(t *testing.T) {
+    srv := lttest.NewServer()
+    defer srv.Close()
+    srv.OnWorker(func(w *lttest.Worker) {
+        if w.Media == "audio/pcm" { w.Push(lttest.Packet{Data: make([]byte, 8), Meta: lt.AudioMetadata{Channels: 2, Samplerate: 48000, Depth: 16}}) }
+    })
+    cli := cv40.NewRealClient(config.Config{BaseURL: srv.Agent()})
+    defer cli.Close()
+    m := NewManager(cli)
+
+    dir := t.TempDir()
+    if _, err := m.Start([]string{dir}, "video/mp4"); err != nil { t.Fatal(err) }
+    if err := m.StartAudio([]string{filepath.Join(dir, "first")}, 0); err != nil { t.Fatal(err) }
+    if err := m.StartAudio([]string{dir}, 0); err != nil { t.Fatal(err) }
+    if w := srv.Workers()[1]; w.Media != "audio/pcm" || w.Status() != "completed" { t.Errorf("first %s worker %s, want completed", w.Media, w.Status()) }
+
+    results, err := m.Stop()
+    if err != nil { t.Fatal(err) }
+    for i, w := range srv.Workers() { if w.Status() != "completed" { t.Errorf("worker %d %s, want completed", i, w.Status()) } }
+    if len(results) != 1 || len(results[0].Audio) != 1 { t.Fatalf("results %+v, want one audio file", results) }
+    b, err := os.ReadFile(results[0].Audio[0])
+    if err != nil { t.Fatal(err) }
+    if len(b) != 44+8 || binary.LittleEndian.Uint32(b[40:]) != 8 { t.Errorf("audio file of %d bytes, want a closed WAV of 8 bytes of samples", len(b)) }
+}
@@ -12,11 +12,13 @@ const (
     PAUSED         Status = "PAUSED"
     DEGRADED       Status = "DEGRADED"
     ERROR_BLOCKING Status = "ERROR_BLOCKING"
+    UPDATING       Status = "UPDATING" // Agent firmware or software update in progress
 )
 
 type Store struct {
-    mu    sync.RWMutex
-    state Status
+    mu     sync.RWMutex
+    state  Status
+    reason string // Why the service is DEGRADED or ERROR_BLOCKING, if known
 }
 
 func NewStore() *Store { return &Store{state: BOOTING} }
@@ -27,8 +29,28 @@ func (s *Store) Get() Status {
     return s.state
 }
 
-func (s *Store) Set(st Status) {
+// Reason returns why the state was set, "" if not given
+func (s *Store) Reason() string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.reason
+}
+
+func (s *Store) Set(st Status) { s.SetReason(st, "") }
+
+// SetReason sets the state with a readable reason, eg for DEGRADED
+func (s *Store) SetReason(st Status, reason string) {
     s.mu.Lock()
-    s.state = st
+    s.state, s.reason = st, reason
     s.mu.Unlock()
 }
+
+// Recover sets READY back if the state is still DEGRADED for reason, a state
+// or reason set since is kept
+func (s *Store) Recover(reason string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.state != DEGRADED || s.reason != reason { return false }
+    s.state, s.reason = READY, ""
+    return true
+}
@@ -0,0 +1,12 @@
+package state
+
+import "testing"
+
+func TestRecover(t *testing.T) {
+    s := NewStore()
+    s.SetReason(DEGRADED, "agent version 1.1.0 lacks low-light")
+    if s.Recover("storage: no target") || s.Get() != DEGRADED { t.Errorf("recovered from another reason: %s", s.Get()) }
+    if !s.Recover("agent version 1.1.0 lacks low-light") || s.Get() != READY || s.Reason() != "" { t.Errorf("state %s %q, want READY", s.Get(), s.Reason()) }
+    s.Set(RECORDING)
+    if s.Recover("") || s.Get() != RECORDING { t.Errorf("recovered from %s", s.Get()) }
+}
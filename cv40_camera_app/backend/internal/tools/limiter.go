@@ -1,6 +1,7 @@
 package tools
 
 import (
+    "fmt"
     "time"
     lt "lt/client/go"
     "cv40-camera-backend/internal/config"
@@ -8,82 +9,82 @@ import (
     "cv40-camera-backend/internal/overlay"
 )
 
+// Limiter rate limits settings patches, the patches received within a tick
+// are merged so only the fields set by the caller are posted
 type Limiter struct {
     ranges config.SafeRanges
     cli *cv40.RealClient
     ov *overlay.Engine
-    colorsCh chan lt.CameraColors
-    visualsCh chan lt.CameraVisuals
+    colorsCh chan lt.JSON
+    visualsCh chan lt.JSON
 }
 
 func NewLimiter(cli *cv40.RealClient, ov *overlay.Engine, ranges config.SafeRanges) *Limiter {
-    l := &Limiter{cli: cli, ov: ov, ranges: ranges, colorsCh: make(chan lt.CameraColors, 8), visualsCh: make(chan lt.CameraVisuals, 8)}
+    l := &Limiter{cli: cli, ov: ov, ranges: ranges, colorsCh: make(chan lt.JSON, 8), visualsCh: make(chan lt.JSON, 8)}
     l.start()
     return l
 }
 
 func (l *Limiter) start() {
-    go func() {
-        var last lt.CameraColors
-        ticker := time.NewTicker(75 * time.Millisecond)
-        defer ticker.Stop()
-        pending := false
-        for {
-            select {
-            case v := <-l.colorsCh:
-                v = l.clampColors(v)
-                last = v
-                pending = true
-            case <-ticker.C:
-                if pending {
-                    _ = l.cli.SetColors(last)
-                    l.ov.Slider("Colors", "applied", 800)
-                    pending = false
-                }
-            }
-        }
-    }()
-    go func() {
-        var last lt.CameraVisuals
-        ticker := time.NewTicker(75 * time.Millisecond)
-        defer ticker.Stop()
-        pending := false
-        for {
-            select {
-            case v := <-l.visualsCh:
-                v = l.clampVisuals(v)
-                last = v
-                pending = true
-            case <-ticker.C:
-                if pending {
-                    _ = l.cli.SetVisuals(last)
-                    l.ov.Slider("Visuals", "applied", 800)
-                    pending = false
-                }
+    go l.run("Colors", l.colorsCh, l.cli.PatchColors)
+    go l.run("Visuals", l.visualsCh, l.cli.PatchVisuals)
+}
+
+func (l *Limiter) run(name string, ch chan lt.JSON, patch func(lt.JSON) ([]lt.Change, error)) {
+    last := lt.JSON{}
+    ticker := time.NewTicker(75 * time.Millisecond)
+    defer ticker.Stop()
+    for {
+        select {
+        case p := <-ch:
+            for k, v := range p { last[k] = v }
+        case <-ticker.C:
+            if len(last) > 0 {
+                if _, err := patch(last); err == nil { l.ov.Slider(name, "applied", 800) }
+                last = lt.JSON{}
             }
         }
-    }()
+    }
 }
 
-func (l *Limiter) clampColors(v lt.CameraColors) lt.CameraColors {
-    if v.Brightness < l.ranges.Brightness[0] { v.Brightness = l.ranges.Brightness[0] }
-    if v.Brightness > l.ranges.Brightness[1] { v.Brightness = l.ranges.Brightness[1] }
-    if v.Contrast < l.ranges.Contrast[0] { v.Contrast = l.ranges.Contrast[0] }
-    if v.Contrast > l.ranges.Contrast[1] { v.Contrast = l.ranges.Contrast[1] }
-    if v.Saturation < l.ranges.Saturation[0] { v.Saturation = l.ranges.Saturation[0] }
-    if v.Saturation > l.ranges.Saturation[1] { v.Saturation = l.ranges.Saturation[1] }
-    if v.Hue < l.ranges.Hue[0] { v.Hue = l.ranges.Hue[0] }
-    if v.Hue > l.ranges.Hue[1] { v.Hue = l.ranges.Hue[1] }
-    return v
+func (l *Limiter) clampColors(p lt.JSON) error {
+    for _, err := range []error{
+        clamp(p, "brightness", float64(l.ranges.Brightness[0]), float64(l.ranges.Brightness[1])),
+        clamp(p, "contrast", float64(l.ranges.Contrast[0]), float64(l.ranges.Contrast[1])),
+        clamp(p, "saturation", float64(l.ranges.Saturation[0]), float64(l.ranges.Saturation[1])),
+        clamp(p, "hue", float64(l.ranges.Hue[0]), float64(l.ranges.Hue[1])),
+    } { if err != nil { return err } }
+    return nil
 }
 
-func (l *Limiter) clampVisuals(v lt.CameraVisuals) lt.CameraVisuals {
-    if v.Zoom < l.ranges.Zoom[0] { v.Zoom = l.ranges.Zoom[0] }
-    if v.Zoom > l.ranges.Zoom[1] { v.Zoom = l.ranges.Zoom[1] }
-    if v.Sharpness < l.ranges.Sharpness[0] { v.Sharpness = l.ranges.Sharpness[0] }
-    if v.Sharpness > l.ranges.Sharpness[1] { v.Sharpness = l.ranges.Sharpness[1] }
-    return v
+func (l *Limiter) clampVisuals(p lt.JSON) error {
+    if err := clamp(p, "zoom", l.ranges.Zoom[0], l.ranges.Zoom[1]); err != nil { return err }
+    return clamp(p, "sharpness", l.ranges.Sharpness[0], l.ranges.Sharpness[1])
 }
 
-func (l *Limiter) Colors(v lt.CameraColors) { select { case l.colorsCh <- v: default: } }
-func (l *Limiter) Visuals(v lt.CameraVisuals) { select { case l.visualsCh <- v: default: } }
+// clamp a numeric field of a patch, absent fields are left unset. Other
+// values would reach the agent unchecked: they are refused.
+func clamp(p lt.JSON, key string, min, max float64) error {
+    d, ok := p[key]
+    if !ok { return nil }
+    v, ok := d.(float64)
+    if !ok { return fmt.Errorf("%s: %v is not a number", key, d) }
+    if v < min { v = min }
+    if v > max { v = max }
+    p[key] = v
+    return nil
+}
+
+// Colors clamps the fields of p to the safe ranges and queues it, a field
+// of a range which is not a number is refused
+func (l *Limiter) Colors(p lt.JSON) error {
+    if err := l.clampColors(p); err != nil { return err }
+    select { case l.colorsCh <- p: default: }
+    return nil
+}
+
+func (l *Limiter) Visuals(p lt.JSON) error {
+    if err := l.clampVisuals(p); err != nil { return err }
+    select { case l.visualsCh <- p: default: }
+    return nil
+}
@@ -0,0 +1,33 @@
+package tools
+
+import (
+    "testing"
+    lt "lt/client/go"
+    "cv40-camera-backend/internal/config"
+)
+
+func TestClamp(t *testing.T) {
+    l := &Limiter{ranges: config.SafeRanges{Brightness: [2]int{-50, 50}, Zoom: [2]float64{1, 4}}}
+    tests := []struct {
+        name    string
+        colors  bool
+        patch   lt.JSON
+        want    lt.JSON
+        invalid bool
+    }{
+        {"in range", true, lt.JSON{"brightness": 10.0}, lt.JSON{"brightness": 10.0}, false},
+        {"clamped", true, lt.JSON{"brightness": 90.0}, lt.JSON{"brightness": 50.0}, false},
+        {"unranged", true, lt.JSON{"gamma": "x"}, lt.JSON{"gamma": "x"}, false},
+        {"string", true, lt.JSON{"brightness": "90"}, nil, true},
+        {"bool", false, lt.JSON{"zoom": true}, nil, true},
+        {"object", false, lt.JSON{"zoom": map[string]any{"x": 9.0}}, nil, true},
+        {"null", false, lt.JSON{"zoom": nil}, nil, true},
+    }
+    for _, tt := range tests {
+        clamp := l.clampVisuals
+        if tt.colors { clamp = l.clampColors }
+        err := clamp(tt.patch)
+        if (err != nil) != tt.invalid { t.Errorf("%s: %v, want invalid %v", tt.name, err, tt.invalid); continue }
+        for k, v := range tt.want { if tt.patch[k] != v { t.Errorf("%s: %s %v, want %v", tt.name, k, tt.patch[k], v) } }
+    }
+}
@@ -0,0 +1,69 @@
+package video
+
+import (
+    "context"
+    "time"
+    lt "lt/client/go"
+    "cv40-camera-backend/internal/cv40"
+)
+
+const (
+    SignalLost    = "signal_lost"
+    SignalLocked  = "signal_locked"
+    FormatChanged = "format_changed"
+)
+
+// Event of the camera video signal, Previous is the last known signal
+type Event struct {
+    Type     string
+    Previous lt.VideoSignal
+    Current  lt.VideoSignal
+}
+
+// Monitor polls the video signal of the configured camera. Agent errors are
+// not a signal loss, the signal is kept until the agent answers again.
+type Monitor struct {
+    cli      *cv40.RealClient
+    interval time.Duration
+}
+
+func NewMonitor(cli *cv40.RealClient, interval time.Duration) *Monitor {
+    if interval <= 0 { interval = 500 * time.Millisecond }
+    return &Monitor{cli: cli, interval: interval}
+}
+
+// Run calls fn with each signal transition until ctx is done. A signal not
+// locked at start is reported as lost.
+func (m *Monitor) Run(ctx context.Context, fn func(Event)) {
+    var last lt.VideoSignal
+    known := false
+    ticker := time.NewTicker(m.interval)
+    defer ticker.Stop()
+    for {
+        cam, err := m.cli.Camera(ctx)
+        if err == nil {
+            cur := cam.Video
+            switch {
+            case !known:
+                if !Locked(cur) { fn(Event{Type: SignalLost, Current: cur}) }
+            case Locked(last) && !Locked(cur):
+                fn(Event{Type: SignalLost, Previous: last, Current: cur})
+            case !Locked(last) && Locked(cur):
+                fn(Event{Type: SignalLocked, Previous: last, Current: cur})
+            case Locked(cur) && !SameFormat(last, cur):
+                fn(Event{Type: FormatChanged, Previous: last, Current: cur})
+            }
+            last, known = cur, true
+        }
+        select {
+        case <-ctx.Done(): return
+        case <-ticker.C:
+        }
+    }
+}
+
+func Locked(v lt.VideoSignal) bool { return v.Signal == "locked" }
+
+func SameFormat(a, b lt.VideoSignal) bool {
+    return a.Size == b.Size && a.Framerate == b.Framerate && a.Interlaced == b.Interlaced && a.Format == b.Format
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
@@ -90,7 +91,7 @@ func (c *MockClient) mockGet(url string, response any) error {
 	log.Printf("MOCK GET %s", url)
 	
 	switch {
-	case url == "cv40:/0/camera/0":
+	case url == camera.URL():
 		if cam, ok := response.(*lt.Camera); ok {
 			*cam = lt.Camera{
 				Model: "Mock Camera",
@@ -100,22 +101,14 @@ func (c *MockClient) mockGet(url string, response any) error {
 				},
 			}
 		}
-	case url == "cv40:/0/camera/0/visuals":
-		if v, ok := response.(*lt.CameraVisuals); ok {
-			*v = mockTransport.settings.Visuals
-		}
-	case url == "cv40:/0/camera/0/colors":
-		if v, ok := response.(*lt.CameraColors); ok {
-			*v = mockTransport.settings.Colors
-		}
-	case url == "cv40:/0/camera/0/white":
-		if v, ok := response.(*lt.CameraWhite); ok {
-			*v = mockTransport.settings.White
-		}
-	case url == "cv40:/0/camera/0/exposure":
-		if v, ok := response.(*lt.CameraExposure); ok {
-			*v = mockTransport.settings.Exposure
-		}
+	case url == camera.Visuals().URL():
+		mockCopy(response, mockTransport.settings.Visuals)
+	case url == camera.Colors().URL():
+		mockCopy(response, mockTransport.settings.Colors)
+	case url == camera.White().URL():
+		mockCopy(response, mockTransport.settings.White)
+	case url == camera.Exposure().URL():
+		mockCopy(response, mockTransport.settings.Exposure)
 	}
 	return nil
 }
@@ -124,23 +117,19 @@ func (c *MockClient) mockPost(url string, body, response any) error {
 	log.Printf("MOCK POST %s", url)
 	
 	switch {
-	case url == "cv40:/0/camera/0/visuals":
-		if v, ok := body.(*lt.CameraVisuals); ok {
-			mockTransport.settings.Visuals = *v
-		}
-	case url == "cv40:/0/camera/0/colors":
-		if v, ok := body.(*lt.CameraColors); ok {
-			mockTransport.settings.Colors = *v
-		}
-	case url == "cv40:/0/camera/0/white":
-		if v, ok := body.(*lt.CameraWhite); ok {
-			mockTransport.settings.White = *v
-		}
-	case url == "cv40:/0/camera/0/exposure":
-		if v, ok := body.(*lt.CameraExposure); ok {
-			mockTransport.settings.Exposure = *v
-		}
-	case url == "cv40:/0/camera/0/file":
+	case url == camera.Visuals().URL():
+		mockCopy(&mockTransport.settings.Visuals, body)
+		mockCopy(response, mockTransport.settings.Visuals)
+	case url == camera.Colors().URL():
+		mockCopy(&mockTransport.settings.Colors, body)
+		mockCopy(response, mockTransport.settings.Colors)
+	case url == camera.White().URL():
+		mockCopy(&mockTransport.settings.White, body)
+		mockCopy(response, mockTransport.settings.White)
+	case url == camera.Exposure().URL():
+		mockCopy(&mockTransport.settings.Exposure, body)
+		mockCopy(response, mockTransport.settings.Exposure)
+	case url == camera.FileURL():
 		// Mock file worker creation - return redirect error with fake worker URL
 		if _, ok := body.(lt.ImageFileWorker); ok {
 			return fmt.Errorf("%w: mock://worker/image/%d", lt.ErrRedirect, rand.Int())
@@ -158,6 +147,16 @@ func (c *MockClient) mockPost(url string, body, response any) error {
 	return nil
 }
 
+// mockCopy copies src to dst through JSON, for settings posted as structs or lt.JSON patches
+func mockCopy(dst, src any) {
+	if dst == nil || src == nil {
+		return
+	}
+	if b, err := json.Marshal(src); err == nil {
+		json.Unmarshal(b, dst)
+	}
+}
+
 // Helper to create a mock-aware client
 func createClient() *MockClient {
 	return NewMockClient()
@@ -110,13 +110,17 @@ func broadcastPhotoCapture() {
 	})
 }
 
-// Broadcast white balance progress
-func broadcastWhiteBalance(complete bool) {
+// Broadcast white balance result, details hold the gains or the failure reason
+func broadcastWhiteBalance(complete bool, details map[string]interface{}) {
+	data := map[string]interface{}{
+		"complete": complete,
+	}
+	for k, v := range details {
+		data[k] = v
+	}
 	monitorServer.broadcast(OSDEvent{
 		Type: "white_balance",
-		Data: map[string]interface{}{
-			"complete": complete,
-		},
+		Data: data,
 	})
 }
 
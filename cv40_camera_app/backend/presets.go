@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	lt "lt/client/go"
+)
+
+var errUnknownPreset = errors.New("unknown preset")
+
+// cameraPreset holds the fields a preset patches, other settings are kept
+type cameraPreset struct {
+	Colors  lt.JSON
+	Visuals lt.JSON
+	White   lt.JSON
+}
+
+var presets = map[string]cameraPreset{
+	// Default arthroscopy settings
+	"arthroscopy": {
+		Colors:  lt.JSON{"brightness": 10, "contrast": 15, "saturation": 5, "hue": 0, "gamma": 1.0, "colorGain": []float64{1.0, 1.0, 1.0}},
+		Visuals: lt.JSON{"zoom": 1.0, "sharpness": 0.7},
+		White:   lt.JSON{"temperature": 6500},
+	},
+	// Red boost preset - enhanced reds and yellows for better tissue contrast
+	"red_boost": {
+		Colors:  lt.JSON{"brightness": 20, "contrast": 25, "saturation": 15, "hue": -5, "gamma": 0.9, "colorGain": []float64{1.2, 0.95, 0.85}}, // Boost red, slightly reduce green/blue
+		Visuals: lt.JSON{"zoom": 1.0, "sharpness": 0.8},
+		White:   lt.JSON{"temperature": 5800}, // Warmer temperature
+	},
+}
+
+// applyPreset patches the camera with a named preset
+func applyPreset(client lt.Caller, name string) error {
+	preset, ok := presets[name]
+	if !ok {
+		return errUnknownPreset
+	}
+	if _, _, err := camera.Colors().Patch(client, preset.Colors); err != nil {
+		return err
+	}
+	if _, _, err := camera.Visuals().Patch(client, preset.Visuals); err != nil {
+		return err
+	}
+	_, _, err := camera.White().Patch(client, preset.White)
+	return err
+}
+
+// Overlay names of the broadcast camera parameters
+var parameterNames = map[string]string{
+	"zoom":         "Zoom",
+	"sharpness":    "Sharpness",
+	"brightness":   "Brightness",
+	"contrast":     "Contrast",
+	"saturation":   "Saturation",
+	"hue":          "Hue",
+	"temperature":  "Temperature",
+	"lowLightGain": "LowLightGain",
+}
+
+// broadcastChanges broadcasts the parameters actually changed by a patch
+func broadcastChanges(changes []lt.Change) {
+	for _, c := range changes {
+		name, ok := parameterNames[c.Field]
+		if !ok {
+			continue
+		}
+		if v, ok := c.After.(float64); ok {
+			broadcastParameterChange(name, v)
+		}
+	}
+}
+
+// settingsStatus maps a settings error to an HTTP status
+func settingsStatus(err error) int {
+	if errors.Is(err, errUnknownPreset) || lt.ErrorKindOf(err) == lt.KindInvalidArgument {
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
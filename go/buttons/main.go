@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"log"
+	"math"
 
 	lt "lt/client/go"
 )
@@ -11,53 +13,38 @@ func main() {
 	var client lt.Client
 	defer client.Close()
 
-	// Flag to track if the visuals have changed
-	var zoomChanged bool
+	// Camera head buttons, "cv40:/0/buttons" for the board ones
+	camera := lt.At("cv40").Board(0).Camera(0)
+	events, err := lt.WatchButtons(context.Background(), camera.URL()+"/buttons", lt.ButtonOptions{Client: &client})
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Get the current zoom level
-	var visuals lt.CameraVisuals
-	if err := client.Get("cv40:/0/camera/0/visuals", &visuals); err != nil {
+	visuals, err := camera.Visuals().Get(&client)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	for {
-		// URL to get the state of the buttons
-		sourceURL := "cv40:/0/camera/0/buttons" // "cv40:/0/buttons" / "cv40:/0/camera/0/buttons"
-
-		// Get buttons state
-		var buttons lt.Buttons
-		if err := client.Get(sourceURL, &buttons); err != nil {
-			log.Fatal(err)
-		}
-
-		if len(buttons.Buttons) == 0 {
-			log.Fatal("Not enough buttons available")
-		}
-
-		// Zoom in if the first button is pressed
-		if !buttons.Buttons[0].Pressed {
-			visuals.Zoom += 0.1
-			if visuals.Zoom >= 4.0 {
-				visuals.Zoom = 4.0
-			}
-			zoomChanged = true
-		}
-
-		// Zoom out if the second button is pressed
-		if !buttons.Buttons[1].Pressed {
-			visuals.Zoom -= 0.1
-			if visuals.Zoom <= 1.0 {
-				visuals.Zoom = 1.0
-			}
-			zoomChanged = true
+	for e := range events {
+		zoom := visuals.Zoom
+		switch {
+		// Zoom in with the first button, out with the second one
+		case e.Type == lt.ButtonClick && e.Button == 0:
+			zoom = math.Min(zoom+0.1, 4.0)
+		case e.Type == lt.ButtonClick && e.Button == 1:
+			zoom = math.Max(zoom-0.1, 1.0)
+
+		// Reset the zoom with a long press
+		case e.Type == lt.ButtonLongPress:
+			zoom = 1.0
 		}
 
-		// Set the new zoom level if it has changed
-		if zoomChanged {
-			if err := client.Post("cv40:/0/camera/0/visuals", &visuals, nil); err != nil {
+		// Set the new zoom level if it has changed, other visuals are kept
+		if zoom != visuals.Zoom {
+			if visuals, _, err = camera.Visuals().Patch(&client, lt.JSON{"zoom": zoom}); err != nil {
 				log.Fatal(err)
 			}
-			zoomChanged = false
 		}
 	}
 }
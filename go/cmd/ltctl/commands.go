@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	lt "lt/client/go"
+)
+
+func get(ctx context.Context, c *lt.Client, args []string) error {
+	url, err := urlArg(flag.NewFlagSet("get", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	var v lt.JSON
+	if err := c.GetContext(ctx, url, &v); err != nil {
+		return err
+	}
+	fmt.Println(v)
+	return nil
+}
+
+func post(ctx context.Context, c *lt.Client, args []string) error {
+	fs := flag.NewFlagSet("post", flag.ContinueOnError)
+	data := fs.String("d", "", "JSON body")
+	file := fs.String("f", "", "JSON body file, - for stdin")
+	url, err := urlArg(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// Body from -d, -f or a pipe, {} otherwise
+	var b []byte
+	switch {
+	case *data != "" && *file != "":
+		return usageError("-d and -f are exclusive")
+	case *data != "":
+		b = []byte(*data)
+	case *file == "-" || *file == "" && piped(os.Stdin):
+		b, err = io.ReadAll(os.Stdin)
+	case *file != "":
+		b, err = os.ReadFile(*file)
+	default:
+		b = []byte("{}")
+	}
+	if err != nil {
+		return err
+	}
+	var body lt.JSON
+	if err := json.Unmarshal(b, &body); err != nil {
+		return usageError("body: " + err.Error())
+	}
+
+	// Worker creations answer the worker location
+	var response lt.JSON
+	err = c.PostContext(ctx, url, body, &response)
+	if errors.Is(err, lt.ErrRedirect) {
+		response, err = lt.JSON{"location": lt.RedirectLocation(err)}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(response) > 0 {
+		fmt.Println(response)
+	}
+	return nil
+}
+
+func piped(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+func del(ctx context.Context, c *lt.Client, args []string) error {
+	url, err := urlArg(flag.NewFlagSet("delete", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	return c.DeleteContext(ctx, url)
+}
+
+//
+// Watch
+//
+
+// Print the resource, then its changes at each poll. Poll errors are printed
+// once until the resource answers again, eg while the agent restarts.
+func watch(ctx context.Context, c *lt.Client, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", time.Second, "poll interval")
+	url, err := urlArg(fs, args)
+	if err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return usageError("invalid interval")
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	var last map[string]string
+	var lastErr string
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, max(*interval, 5*time.Second))
+		var v lt.JSON
+		err := c.GetContext(pollCtx, url, &v)
+		cancel()
+		now := time.Now().Format("15:04:05.000")
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			if err.Error() != lastErr {
+				fmt.Fprintln(os.Stderr, now, "error:", err)
+			}
+			lastErr = err.Error()
+		case last == nil:
+			fmt.Println(v)
+			last = flatten(v)
+		default:
+			if lastErr != "" {
+				fmt.Println(now, "back")
+			}
+			lastErr = ""
+			next := flatten(v)
+			diff(now, last, next)
+			last = next
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// Leaf values of a JSON object by dotted key, eg "video.signal", arrays as
+// whole values
+func flatten(v lt.JSON) map[string]string {
+	leaves := map[string]string{}
+	var walk func(prefix string, m map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for k, v := range m {
+			if o, ok := v.(map[string]any); ok && len(o) > 0 {
+				walk(prefix+k+".", o)
+				continue
+			}
+			b, _ := json.Marshal(v)
+			leaves[prefix+k] = string(b)
+		}
+	}
+	walk("", v)
+	return leaves
+}
+
+func diff(now string, from, to map[string]string) {
+	keys := make([]string, 0, len(from)+len(to))
+	for k := range from {
+		keys = append(keys, k)
+	}
+	for k := range to {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		a, inFrom := from[k]
+		b, inTo := to[k]
+		switch {
+		case !inFrom:
+			fmt.Printf("%s + %s: %s\n", now, k, b)
+		case !inTo:
+			fmt.Printf("%s - %s: %s\n", now, k, a)
+		case a != b:
+			fmt.Printf("%s ~ %s: %s -> %s\n", now, k, a, b)
+		}
+	}
+}
+
+//
+// Workers
+//
+
+// The agent has no worker listing, ids are probed. Workers belong to the
+// client connection which created them, the agent may hide those of others.
+func workers(ctx context.Context, c *lt.Client, args []string) error {
+	if len(args) > 0 && args[0] == "stop" {
+		if len(args) == 1 {
+			return usageError("expected worker ids or urls")
+		}
+		for _, arg := range args[1:] {
+			if err := c.PostContext(ctx, workerURL(arg)+"/stop", nil, nil); err != nil {
+				return err
+			}
+			fmt.Println("stopped", workerURL(arg))
+		}
+		return nil
+	}
+
+	fs := flag.NewFlagSet("workers", flag.ContinueOnError)
+	maxID := fs.Int("max", 64, "highest worker id probed")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() > 0 {
+		return usageError("unexpected " + fs.Arg(0))
+	}
+	ctx = lt.ContextExpecting(ctx, lt.KindNotFound)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tSTATUS\tNAME\tDURATION\tLOCATION")
+	for id := 1; id <= *maxID; id++ {
+		url := workerURL(strconv.Itoa(id))
+		var w lt.Worker
+		err := c.GetContext(ctx, url, &w)
+		if lt.ErrorKindOf(err) == lt.KindNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		d := time.Duration(w.Duration) * time.Millisecond
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%s\n", url, w.Status, w.Name, d, w.Location)
+	}
+	return tw.Flush()
+}
+
+// Worker url of an id, eg "3" to "cv40:/client/jobs/3"
+func workerURL(arg string) string {
+	if _, err := strconv.Atoi(arg); err == nil {
+		arg = "/client/jobs/" + arg
+	}
+	return resolve(arg)
+}
+
+//
+// Canvas
+//
+
+func canvas(ctx context.Context, c *lt.Client, args []string) error {
+	fs := flag.NewFlagSet("canvas", flag.ContinueOnError)
+	id := fs.Int("id", 0, "canvas id")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() == 0 {
+		return usageError("expected text or rect")
+	}
+	p := lt.At(agent).Canvas(*id)
+	shape, args := fs.Arg(0), fs.Args()[1:]
+
+	fs = flag.NewFlagSet("canvas "+shape, flag.ContinueOnError)
+	var position, size, color, fill vec
+	fs.Var(&position, "pos", "position x,y")
+	fs.Var(&size, "size", "size width,height")
+	fs.Var(&color, "color", "color r,g,b,a")
+	switch shape {
+	case "text":
+		text := fs.String("text", "", "text")
+		fontSize := fs.Int("font-size", 48, "font size")
+		align := fs.String("align", "", "alignment, eg center")
+		fs.Var(&fill, "background", "background r,g,b,a")
+		if err := parseShape(fs, args, &color); err != nil {
+			return err
+		}
+		return p.Text().PostContext(ctx, c, lt.CanvasText{
+			Text: *text, Align: *align, FontSize: *fontSize,
+			Color: color.rgba(), Background: fill.rgba(),
+			Position: position.xy(), Size: size.xy(),
+		})
+	case "rect":
+		width := fs.Int("width", 2, "border width")
+		rounded := fs.Int("rounded", 0, "corner radius")
+		fs.Var(&fill, "fill", "fill r,g,b,a")
+		if err := parseShape(fs, args, &color); err != nil {
+			return err
+		}
+		return p.Rectangle().PostContext(ctx, c, lt.CanvasRectangle{
+			Width: *width, Rounded: *rounded,
+			Color: color.rgba(), Fill: fill.rgba(),
+			Position: position.xy(), Size: size.xy(),
+		})
+	}
+	return usageError("unknown shape " + shape)
+}
+
+// Shapes are opaque white by default
+func parseShape(fs *flag.FlagSet, args []string, color *vec) error {
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() > 0 {
+		return usageError("unexpected " + fs.Arg(0))
+	}
+	if *color == nil {
+		*color = vec{255, 255, 255, 255}
+	}
+	return nil
+}
+
+// vec is a comma separated flag value, eg "100,200"
+type vec []int
+
+func (v *vec) String() string {
+	if v == nil {
+		return ""
+	}
+	s := make([]string, len(*v))
+	for i, n := range *v {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+func (v *vec) Set(s string) error {
+	*v = nil
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return err
+		}
+		*v = append(*v, n)
+	}
+	return nil
+}
+
+func (v vec) xy() (a [2]int) {
+	copy(a[:], v)
+	return a
+}
+
+func (v vec) rgba() (a [4]int) {
+	copy(a[:], v)
+	if len(v) == 3 {
+		a[3] = 255
+	}
+	return a
+}
+
+func inventory(ctx context.Context, c *lt.Client, args []string) error {
+	if len(args) > 0 {
+		return usageError("unexpected " + args[0])
+	}
+	inv, err := lt.Discover(ctx, c, agent)
+	if err != nil {
+		return err
+	}
+	return printJSON(inv)
+}
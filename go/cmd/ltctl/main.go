@@ -0,0 +1,198 @@
+// Command ltctl calls the LT agent from the command line, for support and
+// scripting:
+//
+//	ltctl get cv40:/0/camera/0
+//	ltctl post /0/camera/0/colors -d '{"brightness": 10}'
+//	ltctl watch -interval 500ms /0/camera/0
+//	ltctl inventory
+//
+// Urls starting with "/" are relative to -agent, "cv40" by default or
+// $LT_AGENT, any scheme of the client works, eg "tcp://10.0.0.2:8080".
+//
+// Exit codes:
+//
+//	0 success
+//	1 other error
+//	2 usage
+//	3 not found
+//	4 invalid argument
+//	5 busy
+//	6 updating
+//	7 connection: transport error, timeout or closed connection
+//	8 unsupported by the agent version
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	lt "lt/client/go"
+)
+
+const (
+	exitOK = iota
+	exitError
+	exitUsage
+	exitNotFound
+	exitInvalidArgument
+	exitBusy
+	exitUpdating
+	exitConnection
+	exitUnsupported
+)
+
+type command struct {
+	name  string
+	args  string
+	about string
+	run   func(ctx context.Context, c *lt.Client, args []string) error
+}
+
+var commands = []command{
+	{"get", "url", "print a resource", get},
+	{"post", "[-d json | -f file] url", "post a JSON body, from -d, a file, or stdin with -f - or when piped", post},
+	{"delete", "url", "delete a resource, eg a canvas", del},
+	{"watch", "[-interval 1s] url", "poll a resource and print its changes until interrupted", watch},
+	{"workers", "[-max 64] | stop id|url...", "list the workers the agent shows this client, or stop workers", workers},
+	{"canvas", "[-id 0] text|rect [flags]", "draw a text or a rectangle on a canvas", canvas},
+	{"inventory", "", "print the agent boards, cameras, buttons and outputs", inventory},
+}
+
+// Agent root of relative urls
+var agent string
+
+// usageError is a command line mistake, answered with the usage
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func main() {
+	flag.StringVar(&agent, "agent", envOr("LT_AGENT", "cv40"), "agent of relative urls, eg cv40 or tcp://10.0.0.2:8080")
+	timeout := flag.Duration("timeout", 5*time.Second, "call timeout, 0 for none")
+	sockets := flag.String("sockets", "", "directory of the agent local sockets, if not the default one")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	if *sockets != "" {
+		lt.RegisterDialer("", lt.UnixDialer(*sockets))
+	}
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		ctx := context.Background()
+		if *timeout > 0 && name != "watch" {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+		client := &lt.Client{}
+		err := cmd.run(ctx, client, args)
+		client.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ltctl "+name+":", err)
+		}
+		var u usageError
+		if errors.As(err, &u) {
+			fmt.Fprintf(os.Stderr, "usage: ltctl %s %s\n", cmd.name, cmd.args)
+		}
+		os.Exit(exitCode(err))
+	}
+	fmt.Fprintln(os.Stderr, "ltctl: unknown command", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ltctl [flags] command [args]\n\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.about)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func exitCode(err error) int {
+	var u usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &u):
+		return exitUsage
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitConnection
+	}
+	switch lt.ErrorKindOf(err) {
+	case lt.KindNotFound:
+		return exitNotFound
+	case lt.KindInvalidArgument:
+		return exitInvalidArgument
+	case lt.KindBusy:
+		return exitBusy
+	case lt.KindUpdating:
+		return exitUpdating
+	case lt.KindTransport, lt.KindClosed:
+		return exitConnection
+	case lt.KindUnsupported:
+		return exitUnsupported
+	}
+	return exitError
+}
+
+func envOr(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+// Absolute url of an argument, eg "/0/camera/0" to "cv40:/0/camera/0"
+func resolve(arg string) string {
+	if strings.HasPrefix(arg, "/") {
+		return strings.TrimSuffix(lt.At(agent).URL(), "/") + arg
+	}
+	return arg
+}
+
+// One url argument, before or after the command flags
+func urlArg(fs *flag.FlagSet, args []string) (string, error) {
+	var urls []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", usageError(err.Error())
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		urls, args = append(urls, fs.Arg(0)), fs.Args()[1:]
+	}
+	if len(urls) != 1 {
+		return "", usageError("expected one url")
+	}
+	return resolve(urls[0]), nil
+}
+
+// Print a value as indented JSON
+func printJSON(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var j lt.JSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	fmt.Println(j)
+	return nil
+}
@@ -0,0 +1,306 @@
+// Command ltrecord records agent sources to files without a terminal, for soak
+// tests and quick captures:
+//
+//	ltrecord -source cv40:/0/camera/0 -source cv40:/0/hdmi-in/0 -dest /data/rec \
+//		-duration 1h -split-duration 10m -codec h264 -bitrate 12000000 -gop 60 -audio audio/wav
+//
+// Each source records to its own file worker, in -dest or, with several
+// sources, in a directory per source. SIGINT or SIGTERM stop the workers,
+// which finalize their files. A JSON summary of the files written is printed
+// on stdout, progress and errors on stderr.
+//
+// Exit codes: 0 when every worker completed, 1 when one failed, 2 for usage.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	lt "lt/client/go"
+)
+
+// sources is a repeatable flag, values may also be comma separated
+type sources []string
+
+func (s *sources) String() string { return strings.Join(*s, ",") }
+
+func (s *sources) Set(v string) error {
+	for _, src := range strings.Split(v, ",") {
+		if src = strings.TrimSpace(src); src != "" {
+			*s = append(*s, src)
+		}
+	}
+	return nil
+}
+
+type options struct {
+	dest          string
+	media         string
+	audio         string
+	duration      time.Duration
+	splitSize     int
+	splitDuration time.Duration
+	extra         lt.VideoEncoderExtra
+	finalize      time.Duration
+}
+
+// Summary of a recording, printed as JSON
+type Summary struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Stopped string    `json:"stopped"` // "completed", "signal" or "error"
+	Workers []Result  `json:"workers"`
+}
+
+type Result struct {
+	Source   string `json:"source"`
+	Media    string `json:"media"`
+	Worker   string `json:"worker"` // Worker url, "" if not created
+	Location string `json:"location"`
+	Files    []File `json:"files"`
+	Packets  int    `json:"packets"`
+	Error    string `json:"error,omitempty"`
+}
+
+type File struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"` // Bytes written, as reported by the worker
+}
+
+func main() {
+	var srcs sources
+	var opts options
+	flag.Var(&srcs, "source", "source url, repeatable or comma separated (default cv40:/0/camera/0)")
+	flag.StringVar(&opts.dest, "dest", ".", "destination directory")
+	flag.StringVar(&opts.media, "media", "video/mp4", "video file media")
+	flag.StringVar(&opts.audio, "audio", "", "audio track file media, eg audio/wav, none by default")
+	flag.DurationVar(&opts.duration, "duration", 0, "recording duration in whole seconds, 0 until interrupted")
+	flag.IntVar(&opts.splitSize, "split-size", 0, "file split size in bytes, 0 for none")
+	flag.DurationVar(&opts.splitDuration, "split-duration", 0, "file split duration in whole seconds, 0 for none")
+	flag.StringVar(&opts.extra.Codec, "codec", "", "video codec, eg h264 or hevc, the agent default if empty")
+	flag.IntVar(&opts.extra.Bitrate, "bitrate", 0, "video bitrate in bit/s, eg 12000000, the agent default if 0")
+	flag.IntVar(&opts.extra.GOP, "gop", 0, "video group of pictures length, the agent default if 0")
+	flag.StringVar(&opts.extra.HW, "hw", "", "hardware encoder, the agent default if empty")
+	flag.DurationVar(&opts.finalize, "finalize", 30*time.Second, "wait for the workers to finalize their files once stopped")
+	flag.Parse()
+	if flag.NArg() > 0 || !seconds(opts.duration) || opts.splitSize < 0 || !seconds(opts.splitDuration) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if len(srcs) == 0 {
+		srcs = sources{"cv40:/0/camera/0"}
+	}
+
+	// The agent writes the files: absolute locations
+	dest, err := filepath.Abs(opts.dest)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ltrecord:", err)
+		os.Exit(2)
+	}
+	opts.dest = dest
+
+	// Worker long polls hold their connection
+	tracks := 1
+	if opts.audio != "" {
+		tracks = 2
+	}
+	client := lt.NewPooledClient(lt.PoolConfig{MaxConns: len(srcs)*tracks + 1})
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	summary := record(ctx, client, srcs, opts)
+
+	b, _ := json.MarshalIndent(summary, "", "  ")
+	fmt.Println(string(b))
+	if summary.Stopped == "error" {
+		os.Exit(1)
+	}
+}
+
+// Record every source until the workers end or ctx is done
+func record(ctx context.Context, c *lt.Client, srcs sources, opts options) Summary {
+	s := Summary{Start: time.Now(), Stopped: "completed"}
+	var jobs []*job
+	for _, src := range srcs {
+		location := opts.dest
+		if len(srcs) > 1 {
+			location = filepath.Join(opts.dest, dirName(src))
+		}
+		jobs = append(jobs, &job{Result: Result{Source: src, Media: opts.media, Location: location}, body: lt.VideoFileWorker{
+			Media:         opts.media,
+			Location:      location,
+			Duration:      int64(opts.duration / time.Second),
+			SplitSize:     opts.splitSize,
+			SplitDuration: int64(opts.splitDuration / time.Second),
+			Extra:         opts.extra,
+		}})
+		if opts.audio != "" {
+			jobs = append(jobs, &job{Result: Result{Source: src, Media: opts.audio, Location: location}, body: lt.AudioFileWorker{
+				Media:         opts.audio,
+				Location:      location,
+				Duration:      int64(opts.duration / time.Second),
+				SplitSize:     opts.splitSize,
+				SplitDuration: int64(opts.splitDuration / time.Second),
+			}})
+		}
+	}
+
+	// Workers are created before any records, a failure stops the others
+	for _, j := range jobs {
+		if err := j.create(ctx, c); err != nil {
+			j.Error = err.Error()
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", j.Source, j.Media, err)
+			s.Stopped = "error"
+			break
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: recording to %s (%s)\n", j.Source, j.Media, j.Location, j.Worker)
+	}
+	if s.Stopped == "error" {
+		stopAll(jobs, opts.finalize)
+		return s.done(jobs)
+	}
+
+	// Workers complete on their own with -duration, or are stopped on a
+	// signal. The packets are read until EOF: the files are final.
+	poll, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			j.run(poll)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.Stopped = "signal"
+		fmt.Fprintln(os.Stderr, "stopping")
+		stopAll(jobs, opts.finalize)
+		select {
+		case <-done:
+		case <-time.After(opts.finalize):
+			fmt.Fprintln(os.Stderr, "workers did not finalize in", opts.finalize)
+			cancel()
+			<-done
+		}
+	}
+	for _, j := range jobs {
+		if j.Error != "" {
+			s.Stopped = "error"
+		}
+	}
+	return s.done(jobs)
+}
+
+func (s Summary) done(jobs []*job) Summary {
+	s.End = time.Now()
+	s.Workers = []Result{}
+	for _, j := range jobs {
+		if j.Files == nil {
+			j.Files = []File{}
+		}
+		s.Workers = append(s.Workers, j.Result)
+	}
+	return s
+}
+
+// The agent takes durations in seconds
+func seconds(d time.Duration) bool {
+	return d >= 0 && d%time.Second == 0
+}
+
+// Directory of a source among several, eg "0-camera-0" for "cv40:/0/camera/0"
+func dirName(src string) string {
+	p := src
+	if i := strings.Index(src, ":"); i >= 0 {
+		p = src[i+1:]
+	}
+	p = strings.Trim(strings.TrimPrefix(p, "//"), "/")
+	return strings.NewReplacer("/", "-", ":", "-").Replace(p)
+}
+
+//
+// Workers
+//
+
+type job struct {
+	Result
+	body any
+	w    *lt.WorkerHandle
+	mu   sync.Mutex
+}
+
+func (j *job) create(ctx context.Context, c *lt.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	w, err := lt.CreateFileWorker(ctx, c, j.Source, j.body)
+	if err != nil {
+		return err
+	}
+	j.w, j.Worker = w, w.URL
+	return w.Start(ctx)
+}
+
+// Read the packets until EOF, noting the files written. Split files are
+// named in turn by the worker.
+func (j *job) run(ctx context.Context) {
+	for _, err := range j.w.Packets(ctx) {
+		j.mu.Lock()
+		if err != nil {
+			j.Error = err.Error()
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", j.Source, j.Media, err)
+		} else {
+			j.Packets++
+			j.note(j.w.Worker())
+		}
+		j.mu.Unlock()
+	}
+	j.mu.Lock()
+	j.note(j.w.Worker())
+	j.mu.Unlock()
+}
+
+func (j *job) note(w lt.Worker) {
+	if w.Name == "" {
+		return
+	}
+	if n := len(j.Files); n > 0 && j.Files[n-1].Name == w.Name {
+		j.Files[n-1].Size = int64(w.Length)
+		return
+	}
+	j.Files = append(j.Files, File{Name: w.Name, Size: int64(w.Length)})
+	fmt.Fprintf(os.Stderr, "%s %s: %s\n", j.Source, j.Media, w.Name)
+}
+
+// Stop the created workers, whose remaining packets are still read
+func stopAll(jobs []*job, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, j := range jobs {
+		if j.w == nil {
+			continue
+		}
+		if err := j.w.Stop(ctx); err != nil && !errors.Is(err, lt.EOF) {
+			fmt.Fprintf(os.Stderr, "%s %s: stop: %v\n", j.Source, j.Media, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// A recording split in two files completes, with both files in the summary
+func TestRecordSplit(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	srv.OnWorker(func(w *lttest.Worker) {
+		go func() {
+			w.SetName("rec-1.mp4")
+			w.Push(lttest.Packet{Data: make([]byte, 100)})
+			time.Sleep(100 * time.Millisecond)
+			w.Split("rec-2.mp4")
+			w.Push(lttest.Packet{Data: make([]byte, 50)})
+			w.End()
+		}()
+	})
+	client := lt.NewPooledClient(lt.PoolConfig{})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := options{dest: t.TempDir(), media: "video/mp4", splitDuration: 10 * time.Minute, finalize: time.Second}
+	s := record(ctx, client, sources{srv.URL("/0/camera/0")}, opts)
+	if s.Stopped != "completed" {
+		t.Fatalf("stopped %q, want completed: %+v", s.Stopped, s.Workers)
+	}
+	files := s.Workers[0].Files
+	if len(files) != 2 || files[0] != (File{"rec-1.mp4", 100}) || files[1] != (File{"rec-2.mp4", 50}) {
+		t.Errorf("files %+v, want rec-1.mp4 then rec-2.mp4", files)
+	}
+
+	// The agent takes seconds
+	var body lt.VideoFileWorker
+	if err := json.Unmarshal(srv.Workers()[0].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.SplitDuration != 600 || body.Duration != 0 {
+		t.Errorf("duration %d and split duration %d, want 0 and 600", body.Duration, body.SplitDuration)
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	for d, want := range map[time.Duration]bool{0: true, time.Second: true, time.Hour: true, 500 * time.Millisecond: false, 1500 * time.Millisecond: false, -time.Second: false} {
+		if seconds(d) != want {
+			t.Errorf("seconds(%v) %v, want %v", d, !want, want)
+		}
+	}
+}
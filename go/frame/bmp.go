@@ -0,0 +1,45 @@
+package frame
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+)
+
+// Uncompressed 24 and 32 bit BMP, as the agent writes them
+func decodeBMP(data []byte) (image.Image, error) {
+	if len(data) < 54 || string(data[:2]) != "BM" {
+		return nil, fmt.Errorf("%w: bmp header", ErrSize)
+	}
+	offset := int(binary.LittleEndian.Uint32(data[10:]))
+	w := int(int32(binary.LittleEndian.Uint32(data[18:])))
+	h := int(int32(binary.LittleEndian.Uint32(data[22:])))
+	bpp := int(binary.LittleEndian.Uint16(data[28:]))
+	compression := binary.LittleEndian.Uint32(data[30:])
+	if (bpp != 24 && bpp != 32) || (compression != 0 && compression != 3) {
+		return nil, fmt.Errorf("%w: bmp %d bits, compression %d", ErrMedia, bpp, compression)
+	}
+
+	// Bottom-up rows unless the height is negative, rows padded to 4 bytes
+	bottomUp := h > 0
+	if !bottomUp {
+		h = -h
+	}
+	n := bpp / 8
+	s := (w*n + 3) &^ 3
+	if w <= 0 || offset+s*h > len(data) {
+		return nil, fmt.Errorf("%w: bmp %dx%d", ErrSize, w, h)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		row := y
+		if bottomUp {
+			row = h - 1 - y
+		}
+		src, dst := data[offset+row*s:], img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = src[n*x+2], src[n*x+1], src[n*x], 0xff
+		}
+	}
+	return img, nil
+}
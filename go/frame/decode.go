@@ -0,0 +1,179 @@
+// Package frame converts data worker packets to image.Image values, and
+// images to canvas image operations.
+//
+// Raw media are laid out as the agent serves them: "yuv422" is planar (Y,
+// then Cb and Cr at half width), "yuyv" packed 4:2:2, "nv12" a Y plane then
+// interleaved CbCr at half width and height, "rgb" and "rgba" packed bytes.
+// Rows may be padded: strides are derived from the data length.
+package frame
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	lt "lt/client/go"
+)
+
+var (
+	ErrMedia = errors.New("frame: unsupported media")
+	ErrSize  = errors.New("frame: data does not match the frame size")
+)
+
+// Decode returns the image of a data worker packet, a *image.YCbCr for the
+// yuv media and a *image.RGBA for the rgb ones. The image does not share the
+// packet data, so the packet may be closed once decoded.
+func Decode(p lt.Packet) (image.Image, error) {
+	data, err := p.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var meta lt.ImageMetadata // Size of the image and video metadata
+	if len(p.Meta) > 0 {
+		if err := json.Unmarshal(p.Meta, &meta); err != nil {
+			return nil, fmt.Errorf("frame: packet metadata: %w", err)
+		}
+	}
+	return DecodeData(p.Media, meta.Size, data)
+}
+
+// DecodeData returns the image of media data, eg "image/nv12" or "nv12" with
+// its {width, height} size. Compressed media (jpeg, png, bmp) ignore size.
+func DecodeData(media string, size [2]int, data []byte) (image.Image, error) {
+	format := Format(media)
+	switch format {
+	case "jpeg":
+		return jpeg.Decode(bytes.NewReader(data))
+	case "png":
+		return png.Decode(bytes.NewReader(data))
+	case "bmp":
+		return decodeBMP(data)
+	}
+
+	w, h := size[0], size[1]
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("%w: %dx%d %s", ErrSize, w, h, media)
+	}
+	switch format {
+	case "yuv422":
+		return decodeYUV422(data, w, h)
+	case "yuyv":
+		return decodeYUYV(data, w, h)
+	case "nv12":
+		return decodeNV12(data, w, h)
+	case "rgba":
+		return decodeRGB(data, w, h, 4)
+	case "rgb":
+		return decodeRGB(data, w, h, 3)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMedia, media)
+}
+
+// Format returns the data format of a media, eg "nv12" for "video/nv12"
+func Format(media string) string {
+	if _, format, ok := strings.Cut(media, "/"); ok {
+		return format
+	}
+	return media
+}
+
+// Row stride of data holding rows rows of at least min bytes, padding included
+func stride(data []byte, rows int, min int) (int, error) {
+	if rows <= 0 || len(data) < rows*min {
+		return 0, ErrSize
+	}
+	return max(len(data)/rows, min), nil
+}
+
+func decodeYUV422(data []byte, w, h int) (image.Image, error) {
+	// Y rows then Cb and Cr rows of half the stride, rounded up for odd
+	// widths: a line takes a Y row and two chroma rows
+	cw := (w + 1) / 2
+	l, err := stride(data, h, w+2*cw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %dx%d yuv422", err, w, h)
+	}
+	img := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio422)
+	ys := l / 2
+	cs := (l - ys) / 2
+	cb, cr := data[ys*h:], data[ys*h+cs*h:]
+	for y := 0; y < h; y++ {
+		copy(img.Y[y*img.YStride:y*img.YStride+w], data[y*ys:])
+		copy(img.Cb[y*img.CStride:y*img.CStride+cw], cb[y*cs:])
+		copy(img.Cr[y*img.CStride:y*img.CStride+cw], cr[y*cs:])
+	}
+	return img, nil
+}
+
+func decodeYUYV(data []byte, w, h int) (image.Image, error) {
+	// Rows of whole Y0 Cb Y1 Cr pairs, odd widths pad the last one
+	pairs := (w + 1) / 2
+	s, err := stride(data, h, 4*pairs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %dx%d yuyv", err, w, h)
+	}
+	img := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio422)
+	for y := 0; y < h; y++ {
+		row := data[y*s:]
+		for x := 0; x < w; x += 2 {
+			img.Y[y*img.YStride+x] = row[2*x]
+			img.Cb[y*img.CStride+x/2] = row[2*x+1]
+			if x+1 < w {
+				img.Y[y*img.YStride+x+1] = row[2*x+2]
+			}
+			img.Cr[y*img.CStride+x/2] = row[2*x+3]
+		}
+	}
+	return img, nil
+}
+
+func decodeNV12(data []byte, w, h int) (image.Image, error) {
+	// Y rows then half as many CbCr rows, of the same stride unless both are
+	// unpadded: the CbCr rows of odd widths are then one byte longer
+	cw, ch := (w+1)/2, (h+1)/2
+	ys, us := w, 2*cw
+	if len(data) != h*ys+ch*us {
+		s, err := stride(data, h+ch, 2*cw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %dx%d nv12", err, w, h)
+		}
+		ys, us = s, s
+	}
+	img := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio420)
+	uv := data[ys*h:]
+	for y := 0; y < h; y++ {
+		copy(img.Y[y*img.YStride:y*img.YStride+w], data[y*ys:])
+	}
+	for y := 0; y < ch; y++ {
+		row := uv[y*us:]
+		for x := 0; x < cw; x++ {
+			img.Cb[y*img.CStride+x] = row[2*x]
+			img.Cr[y*img.CStride+x] = row[2*x+1]
+		}
+	}
+	return img, nil
+}
+
+func decodeRGB(data []byte, w, h, bpp int) (image.Image, error) {
+	s, err := stride(data, h, bpp*w)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %dx%d %d bytes per pixel", err, w, h, bpp)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		src, dst := data[y*s:], img.Pix[y*img.Stride:]
+		if bpp == 4 {
+			copy(dst[:4*w], src)
+			continue
+		}
+		for x := 0; x < w; x++ {
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = src[3*x], src[3*x+1], src[3*x+2], 0xff
+		}
+	}
+	return img, nil
+}
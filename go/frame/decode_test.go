@@ -0,0 +1,117 @@
+package frame
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestDecodeYUYV(t *testing.T) {
+	tests := []struct {
+		name   string
+		w      int
+		data   []byte // One row
+		y      []byte
+		cb, cr []byte
+	}{
+		{"even", 2, []byte{10, 100, 20, 200}, []byte{10, 20}, []byte{100}, []byte{200}},
+		{"odd padded", 3, []byte{10, 100, 20, 200, 30, 101, 0, 201}, []byte{10, 20, 30}, []byte{100, 101}, []byte{200, 201}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := DecodeData("image/yuyv", [2]int{tt.w, 1}, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ycc := img.(*image.YCbCr)
+			if got := ycc.Y[:tt.w]; string(got) != string(tt.y) {
+				t.Errorf("Y %v, want %v", got, tt.y)
+			}
+			if got := ycc.Cb[:len(tt.cb)]; string(got) != string(tt.cb) {
+				t.Errorf("Cb %v, want %v", got, tt.cb)
+			}
+			if got := ycc.Cr[:len(tt.cr)]; string(got) != string(tt.cr) {
+				t.Errorf("Cr %v, want %v", got, tt.cr)
+			}
+		})
+	}
+
+	// The last pair of odd widths is whole
+	if _, err := DecodeData("image/yuyv", [2]int{3, 1}, make([]byte, 6)); !errors.Is(err, ErrSize) {
+		t.Errorf("odd width without the padded pair: %v, want ErrSize", err)
+	}
+}
+
+func TestDecodeYUV422(t *testing.T) {
+	tests := []struct {
+		name   string
+		w      int
+		data   []byte // One line: Y row, Cb row, Cr row
+		y      []byte
+		cb, cr []byte
+	}{
+		{"even", 2, []byte{1, 2, 10, 20}, []byte{1, 2}, []byte{10}, []byte{20}},
+		{"odd", 3, []byte{1, 2, 3, 10, 11, 20, 21}, []byte{1, 2, 3}, []byte{10, 11}, []byte{20, 21}},
+		{"odd padded", 3, []byte{1, 2, 3, 0, 10, 11, 20, 21}, []byte{1, 2, 3}, []byte{10, 11}, []byte{20, 21}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := DecodeData("image/yuv422", [2]int{tt.w, 1}, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ycc := img.(*image.YCbCr)
+			if got := ycc.Y[:tt.w]; string(got) != string(tt.y) {
+				t.Errorf("Y %v, want %v", got, tt.y)
+			}
+			if got := ycc.Cb[:len(tt.cb)]; string(got) != string(tt.cb) {
+				t.Errorf("Cb %v, want %v", got, tt.cb)
+			}
+			if got := ycc.Cr[:len(tt.cr)]; string(got) != string(tt.cr) {
+				t.Errorf("Cr %v, want %v", got, tt.cr)
+			}
+		})
+	}
+
+	// Odd widths need the last chroma sample
+	if _, err := DecodeData("image/yuv422", [2]int{3, 1}, make([]byte, 6)); !errors.Is(err, ErrSize) {
+		t.Errorf("odd width without the last chroma sample: %v, want ErrSize", err)
+	}
+}
+
+func TestDecodeNV12(t *testing.T) {
+	tests := []struct {
+		name   string
+		w, h   int
+		data   []byte // Y rows then CbCr rows
+		y      []byte // Second Y row
+		cb, cr []byte
+	}{
+		{"even", 2, 2, []byte{1, 2, 3, 4, 10, 20}, []byte{3, 4}, []byte{10}, []byte{20}},
+		{"odd", 3, 2, []byte{1, 2, 3, 4, 5, 6, 10, 20, 11, 21}, []byte{4, 5, 6}, []byte{10, 11}, []byte{20, 21}},
+		{"odd padded", 3, 2, []byte{1, 2, 3, 0, 4, 5, 6, 0, 10, 20, 11, 21}, []byte{4, 5, 6}, []byte{10, 11}, []byte{20, 21}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := DecodeData("image/nv12", [2]int{tt.w, tt.h}, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ycc := img.(*image.YCbCr)
+			if got := ycc.Y[ycc.YStride : ycc.YStride+tt.w]; string(got) != string(tt.y) {
+				t.Errorf("second Y row %v, want %v", got, tt.y)
+			}
+			if got := ycc.Cb[:len(tt.cb)]; string(got) != string(tt.cb) {
+				t.Errorf("Cb %v, want %v", got, tt.cb)
+			}
+			if got := ycc.Cr[:len(tt.cr)]; string(got) != string(tt.cr) {
+				t.Errorf("Cr %v, want %v", got, tt.cr)
+			}
+		})
+	}
+
+	// Odd widths need the last chroma sample
+	if _, err := DecodeData("image/nv12", [2]int{3, 2}, make([]byte, 9)); !errors.Is(err, ErrSize) {
+		t.Errorf("odd width without the last chroma sample: %v, want ErrSize", err)
+	}
+}
@@ -0,0 +1,37 @@
+package frame
+
+import (
+	"image"
+	"image/draw"
+
+	lt "lt/client/go"
+)
+
+// RGBA returns the pixels of img as packed rgba bytes, without row padding
+func RGBA(img image.Image) (data []byte, width, height int) {
+	b := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Stride != 4*b.Dx() {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	}
+	return rgba.Pix[:4*b.Dx()*b.Dy()], b.Dx(), b.Dy()
+}
+
+// CanvasImage returns a canvas image operation drawing img as rgba data, in a
+// container at position of size, the image size if zero
+func CanvasImage(img image.Image, position, size [2]int) lt.CanvasImage {
+	data, w, h := RGBA(img)
+	if size == [2]int{} {
+		size = [2]int{w, h}
+	}
+	return lt.CanvasImage{
+		Op:       "image",
+		Format:   "rgba",
+		Width:    w,
+		Height:   h,
+		Data:     data,
+		Position: position,
+		Size:     size,
+	}
+}
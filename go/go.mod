@@ -1,6 +1,6 @@
 module lt/client/go
 
-go 1.22.5
+go 1.23
 
 require (
 	github.com/go-gl/gl v0.0.0-20231021071112-07e5d0ea2e71
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"strconv"
 
 	lt "lt/client/go"
 )
@@ -11,18 +12,22 @@ func main() {
 	var client lt.Client
 	defer client.Close()
 
+	board := lt.At("cv40").Board(0)
+	canvas := lt.At("cv40").Canvas(0)
+	hdmiOut := board.HDMIOut(0)
+
 	// Find first active input video source
 	var sourceURL string
-	sources := []string{
-		"camera/0",
+	cameras := []int{
+		0,
 	}
-	for _, source := range sources {
-		var input lt.Camera
-		if err := client.Get("cv40:/0/"+source, &input); err != nil {
+	for _, id := range cameras {
+		input, err := board.Camera(id).Get(&client)
+		if err != nil {
 			log.Fatal(err)
 		}
 		if input.Video.Signal == "locked" {
-			sourceURL = source
+			sourceURL = "camera/" + strconv.Itoa(id)
 			break
 		}
 	}
@@ -33,7 +38,7 @@ func main() {
 	}
 
 	// Set hdmi-out source
-	if err := client.Post("cv40:/0/hdmi-out/0", lt.JSON{"source": sourceURL}, nil); err != nil {
+	if err := client.Post(hdmiOut.URL(), lt.JSON{"source": sourceURL}, nil); err != nil {
 		log.Fatal(err)
 	}
 
@@ -41,24 +46,23 @@ func main() {
 	fmt.Printf("hdmi-out source: %s\n", sourceURL)
 
 	// Get hdmi-out source
-	var output lt.Output
-	if err := client.Get("cv40:/0/hdmi-out/0", &output); err != nil {
+	output, err := hdmiOut.Get(&client)
+	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Initialize canvas
-	if err := client.Post("cv40:/canvas/0/init", lt.CanvasInit{Size: output.Video.Size}, nil); err != nil {
+	if err := canvas.Init().Post(&client, lt.CanvasInit{Size: output.Video.Size}); err != nil {
 		log.Fatal(err)
 	}
 
 	// Draw text
-	if err := client.Post("cv40:/canvas/0/text",
+	if err := canvas.Text().Post(&client,
 		lt.CanvasText{
 			Text:     "Hello, World!",
 			FontSize: 200, Color: [4]int{255, 255, 255, 255},
 			Size: output.Video.Size,
-		},
-		nil); err != nil {
+		}); err != nil {
 		log.Fatal(err)
 	}
 
@@ -71,7 +75,7 @@ func main() {
 	 */
 
 	// Set hdmi-out overlay
-	if err := client.Post("cv40:/0/hdmi-out/0", lt.JSON{"overlay": "canvas/0"}, nil); err != nil {
+	if err := client.Post(hdmiOut.URL(), lt.JSON{"overlay": canvas.Source()}, nil); err != nil {
 		log.Fatal(err)
 	}
 
@@ -1,12 +1,13 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
 	"log"
 
 	lt "lt/client/go"
+	"lt/client/go/frame"
+	"lt/client/go/stats"
 )
 
 func main() {
@@ -36,49 +37,49 @@ func main() {
 	}
 
 	// Create worker
-	err := client.Post(sourceURL+"/data", lt.ImageDataWorker{Media: "image/yuv422"}, nil)
-	if !errors.Is(err, lt.ErrRedirect) {
+	worker, err := lt.CreateDataWorker(context.Background(), &client, sourceURL, lt.ImageDataWorker{Media: "image/yuv422"})
+	if err != nil {
 		log.Fatal("worker creation failed:", err)
 	}
-	workerURL := lt.RedirectLocation(err)
 
-	// Fetch worker response
-	var worker lt.Worker
-	if err := client.Get(workerURL, &worker); err != nil {
-		log.Fatal(err)
-	}
+	// First packet, released once the loop body returns
+	for packet, err := range worker.Packets(context.Background()) {
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	// Check packet
-	if len(worker.Packets) == 0 {
-		log.Fatal("worker packet: not found")
-	}
-	packet := worker.Packets[0]
-	defer packet.Close()
+		// Decode frame
+		img, err := frame.Decode(packet)
+		if err != nil {
+			log.Fatal("worker packet:", err)
+		}
 
-	// Packet metadata
-	var meta lt.ImageMetadata
-	if err := json.Unmarshal(packet.Meta, &meta); err != nil {
-		log.Fatal("worker packet metadata:", err)
-	}
+		// Print infos
+		b := img.Bounds()
+		fmt.Printf("%s %dx%d %d bytes\n", sourceURL, b.Dx(), b.Dy(), len(packet.Data))
 
-	// Print infos
-	fmt.Printf("%s %dx%d %d bytes\n", sourceURL, meta.Size[0], meta.Size[1], len(packet.Data))
+		// Luma histogram over the auto exposure window
+		var exposure lt.CameraExposure
+		if err := client.Get(sourceURL+"/exposure", &exposure); err != nil {
+			log.Fatal(err)
+		}
+		var input lt.Camera
+		if err := client.Get(sourceURL, &input); err != nil {
+			log.Fatal(err)
+		}
+		roi := stats.Window(exposure.Window, input.Video.Size, [2]int{b.Dx(), b.Dy()})
+		s := stats.Compute(img, stats.Options{ROI: roi, Bins: 8})
 
-	// Create histogram
-	n := meta.Size[0] * meta.Size[1]
-	h := [8]int{}
-	for i := 0; i < n; i++ {
-		h[packet.Data[i]/32]++
+		// Print histogram
+		fmt.Println("")
+		for i, n := range s.Luma.Histogram {
+			fmt.Printf("%3d..%3d: %.1f%%\n", 32*i, 32*i+31, 100*float64(n)/float64(s.Pixels))
+		}
+		fmt.Println("")
+		fmt.Printf("luma mean %.1f, p5 %d, median %d, p95 %d\n", s.Luma.Mean, s.Luma.P5, s.Luma.Median, s.Luma.P95)
+		fmt.Printf("clipped shadows %.1f%%, highlights %.1f%%\n", 100*s.Shadows, 100*s.Highlights)
+		fmt.Printf("cast %s, gains %.2f\n", s.Cast.Tint, s.Cast.Gains)
+		return
 	}
-
-	// Print histogram
-	fmt.Println("")
-	fmt.Printf("  0.. 31: %.1f%%\n", 100*float64(h[0])/float64(n))
-	fmt.Printf(" 32.. 63: %.1f%%\n", 100*float64(h[1])/float64(n))
-	fmt.Printf(" 64.. 95: %.1f%%\n", 100*float64(h[2])/float64(n))
-	fmt.Printf(" 96..127: %.1f%%\n", 100*float64(h[3])/float64(n))
-	fmt.Printf("128..159: %.1f%%\n", 100*float64(h[4])/float64(n))
-	fmt.Printf("160..191: %.1f%%\n", 100*float64(h[5])/float64(n))
-	fmt.Printf("192..223: %.1f%%\n", 100*float64(h[6])/float64(n))
-	fmt.Printf("224..256: %.1f%%\n", 100*float64(h[7])/float64(n))
+	log.Fatal("worker packet: not found")
 }
@@ -1,14 +1,20 @@
 package lt
 
 import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/url"
-	"strings"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 //
@@ -16,61 +22,108 @@ import (
 //
 
 var (
-	EOF         = io.EOF
-	ErrRedirect = errors.New("redirect")
-	ErrUpdating = errors.New("updating")
-	ErrClosed   = errors.New("use of closed connection")
+	EOF            = io.EOF
+	ErrRedirect    = errors.New("redirect")
+	ErrUpdating    = errors.New("updating")
+	ErrClosed      = errors.New("use of closed connection")
+	ErrReleased    = errors.New("packet: data released")
+	ErrUnsupported = errors.New("unsupported by the agent")
 )
 
-func RedirectLocation(err error) string {
-	location, _ := strings.CutPrefix(err.Error(), ErrRedirect.Error()+": ")
-	return location
-}
-
 //
 // Shared buffers local references
 //
 
 var sharedBuffers = newBuffers()
 
+// Idle mappings kept for reuse, data workers cycle through a few buffers
+const defaultMaxIdleBuffers = 8
+
 type buffers struct {
-	m  map[string]*buffer // Handles
-	mu sync.RWMutex
+	m       map[string]*buffer // Handles
+	idle    *list.List         // Unreferenced buffers, most recently used first
+	maxIdle int
+	mu      sync.RWMutex
 }
 
 func newBuffers() *buffers {
 	return &buffers{
-		m: map[string]*buffer{},
+		m:       map[string]*buffer{},
+		idle:    list.New(),
+		maxIdle: defaultMaxIdleBuffers,
 	}
 }
 
 func (bs *buffers) Load(handle string, size int) (*buffer, bool) {
 	bs.mu.Lock()
 	defer bs.mu.Unlock()
+	b, ok := bs.m[handle]
+	// Mapped too small, eg a buffer reallocated by the agent
+	if ok && len(b.Data) < size {
+		if b.ref > 0 {
+			return nil, false
+		}
+		bs.evict(b)
+		ok = false
+	}
 	// Map shared buffer
-	if _, ok := bs.m[handle]; !ok {
-		b, err := mapBuffer(handle, size)
+	if !ok {
+		var err error
+		b, err = mapBuffer(handle, size)
 		if err != nil {
 			return nil, false
 		}
+		b.key = handle
 		bs.m[handle] = b
 	}
-	bs.m[handle].ref++
+	// Referenced again
+	if b.elem != nil {
+		bs.idle.Remove(b.elem)
+		b.elem = nil
+	}
+	b.ref++
 	// Done
-	return bs.m[handle], true
+	return b, true
 }
 
 func (bs *buffers) Delete(handle string) {
 	bs.mu.Lock()
 	defer bs.mu.Unlock()
-	// Delete shared buffer
-	if b, ok := bs.m[handle]; ok {
-		b.ref -= 1
-		if b.ref <= 0 {
-			//b.Close()
-			//delete(bs.m, handle)
-		}
+	b, ok := bs.m[handle]
+	if !ok || b.ref <= 0 {
+		return
+	}
+	b.ref--
+	if b.ref > 0 {
+		return
+	}
+	// Keep the mapping idle, unmapping the least recently used ones
+	b.elem = bs.idle.PushFront(b)
+	bs.trim()
+}
+
+func (bs *buffers) trim() {
+	for bs.idle.Len() > bs.maxIdle {
+		bs.evict(bs.idle.Back().Value.(*buffer))
+	}
+}
+
+func (bs *buffers) evict(b *buffer) {
+	if b.elem != nil {
+		bs.idle.Remove(b.elem)
+		b.elem = nil
 	}
+	delete(bs.m, b.key)
+	b.Close()
+}
+
+// SetMaxIdleBuffers sets the number of unreferenced shared memory mappings
+// kept for reuse (default 8), zero unmaps buffers as soon as released
+func SetMaxIdleBuffers(n int) {
+	sharedBuffers.mu.Lock()
+	defer sharedBuffers.mu.Unlock()
+	sharedBuffers.maxIdle = max(n, 0)
+	sharedBuffers.trim()
 }
 
 //
@@ -89,8 +142,15 @@ type Packet struct {
 	Meta json.RawMessage
 
 	// Internal
-	handle       string
+	lease        *lease
 	roundTripper *roundTripper
+	gen          int // Connection which received the packet
+}
+
+// Shared memory lease, shared by the copies of a packet
+type lease struct {
+	handle   string
+	released atomic.Bool
 }
 
 // Handle base64 encoded data or shared memory data
@@ -134,7 +194,7 @@ func (p *Packet) UnmarshalJSON(j []byte) error {
 			return errors.New("packet: shared memory data not found")
 		}
 		// Data
-		p.handle = pkt.Handle
+		p.lease = &lease{handle: pkt.Handle}
 		p.Ref = pkt.Ref
 		p.Data = buffer.Data[pkt.Ptr : pkt.Ptr+pkt.Len : pkt.Ptr+pkt.Len]
 	}
@@ -143,23 +203,37 @@ func (p *Packet) UnmarshalJSON(j []byte) error {
 	return nil
 }
 
-// Release references
+// Release references. Shared memory data must not be used afterwards, the
+// buffer may be unmapped or reused by the agent.
 func (p *Packet) Close() error {
-	// Local
-	if p.handle != "" {
-		sharedBuffers.Delete(p.handle)
+	if p.lease == nil {
+		return nil
 	}
+	// Once per packet, whatever the copies
+	if !p.lease.released.CompareAndSwap(false, true) {
+		p.Data = nil
+		return nil
+	}
+	// Local
+	sharedBuffers.Delete(p.lease.handle)
+	p.Data = nil
 	// Remote
 	if p.Ref != "" && p.roundTripper != nil {
-		go func() {
-			p.roundTripper.Call("DELETE", p.Ref, nil, nil)
-			p.roundTripper.Close()
-		}()
+		go p.roundTripper.Release(p.Ref, p.gen)
 	}
 	// Done
 	return nil
 }
 
+// Bytes returns the packet data, or ErrReleased once the packet or one of its
+// copies was closed
+func (p *Packet) Bytes() ([]byte, error) {
+	if p.lease != nil && p.lease.released.Load() {
+		return nil, ErrReleased
+	}
+	return p.Data, nil
+}
+
 //
 // Workers
 //
@@ -181,23 +255,101 @@ type Worker struct {
 //
 
 type roundTripper struct {
-	scheme string
-	conn   net.Conn
-	decode func(any) error
-	encode func(any) error
-	ref    int
-	mu     sync.Mutex
+	scheme  string
+	agent   string
+	conn    net.Conn
+	decode  func(any) error
+	encode  func(any) error
+	ref     int
+	gen     int          // Connections dialed
+	live    atomic.Int64 // Generation of the open connection, 0 once dropped
+	watcher *watcher
+	mu      ctxMutex
+}
+
+// Mutex whose waiters give up with their context, a call never waits on the
+// connection longer than its budget
+type ctxMutex struct {
+	sem  chan struct{}
+	once sync.Once
+}
+
+func (m *ctxMutex) init() {
+	m.once.Do(func() { m.sem = make(chan struct{}, 1) })
+}
+
+func (m *ctxMutex) Lock() {
+	m.init()
+	m.sem <- struct{}{}
 }
 
-func (rt *roundTripper) open(addr string) error {
-	conn, err := dial(addr)
+func (m *ctxMutex) LockContext(ctx context.Context) error {
+	m.init()
+	select {
+	case m.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *ctxMutex) Unlock() {
+	<-m.sem
+}
+
+func (rt *roundTripper) open(ctx context.Context, addr string) error {
+	conn, err := dial(ctx, addr)
 	if err != nil {
 		return err
 	}
-	rt.conn = conn
+	rt.use(conn)
+	return nil
+}
+
+func (rt *roundTripper) use(conn net.Conn) {
+	rt.conn = &onceConn{Conn: conn}
 	rt.decode = json.NewDecoder(conn).Decode
 	rt.encode = json.NewEncoder(conn).Encode
-	return nil
+	if _, ok := conn.(*UARTConn); ok {
+		rt.decode = frameDecoder(conn)
+	}
+}
+
+// Connection closed once: an interrupted exchange closes connections without
+// deadlines, eg pipes, which the call then drops
+type onceConn struct {
+	net.Conn
+	once sync.Once
+	err  error
+}
+
+func (c *onceConn) Close() error {
+	c.once.Do(func() { c.err = c.Conn.Close() })
+	return c.err
+}
+
+// Newline framed decoder for links without integrity, eg UARTs. Noise before
+// a message or garbled lines are skipped, a garbled response times out.
+func frameDecoder(r io.Reader) func(any) error {
+	reader := bufio.NewReaderSize(r, 64<<10)
+	return func(v any) error {
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return err
+			}
+			for i := bytes.IndexByte(line, '{'); i >= 0; {
+				if json.Valid(line[i:]) {
+					return json.Unmarshal(line[i:], v)
+				}
+				j := bytes.IndexByte(line[i+1:], '{')
+				if j < 0 {
+					break
+				}
+				i += 1 + j
+			}
+		}
+	}
 }
 
 func (rt *roundTripper) close() error {
@@ -205,22 +357,23 @@ func (rt *roundTripper) close() error {
 		rt.ref--
 		return nil
 	}
+	return rt.drop()
+}
+
+// Drop the connection whatever the references, the next call dials again.
+// The agent releases the references of the connection with it.
+func (rt *roundTripper) drop() error {
 	rt.scheme = ""
+	rt.ref = 0
 	if rt.conn == nil {
 		return nil
 	}
 	err := rt.conn.Close()
 	rt.conn = nil
+	rt.live.Store(0)
 	return err
 }
 
-func (rt *roundTripper) Clone() *roundTripper {
-	rt.mu.Lock()
-	defer rt.mu.Unlock()
-	rt.ref++
-	return rt
-}
-
 func (rt *roundTripper) Close() error {
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
@@ -228,55 +381,153 @@ func (rt *roundTripper) Close() error {
 }
 
 func (rt *roundTripper) Call(method, location string, body, response any) error {
+	return rt.CallContext(context.Background(), method, location, body, response)
+}
+
+func (rt *roundTripper) CallContext(ctx context.Context, method, location string, body, response any) error {
+	if err := rt.mu.LockContext(ctx); err != nil {
+		return transportError(method, location, err)
+	}
+	defer rt.mu.Unlock()
+	return rt.call(ctx, method, location, body, response)
+}
+
+// Release a shared memory reference on the connection which received it. The
+// reference belongs to the agent client of this connection, so it is never
+// released through a new one, nor counted against it.
+func (rt *roundTripper) Release(ref string, gen int) error {
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
+	if rt.conn == nil || gen != rt.gen {
+		return nil
+	}
+	err := rt.call(context.Background(), "DELETE", ref, nil, nil)
+	if cerr := rt.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (rt *roundTripper) alive() bool {
+	alive, _ := rt.state()
+	return alive
+}
+
+// Connection state, without waiting for a call in progress, eg a worker
+// long-poll
+func (rt *roundTripper) state() (alive bool, gen int) {
+	g := rt.live.Load()
+	return g != 0, int(g)
+}
+
+// Agent request, sent as one JSON line
+type agentRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   any    `json:"body"`
+}
+
+func (rt *roundTripper) call(ctx context.Context, method, location string, body, response any) error {
+	// Validate context
+	if err := ctx.Err(); err != nil {
+		return transportError(method, location, err)
+	}
 
 	// Validate url
 	u, err := url.Parse(location)
 	if err != nil {
-		return err
+		return &Error{Method: method, URL: location, Message: err.Error(), Kind: KindInvalidArgument, Err: err}
 	}
 	if u.Scheme == "" {
-		return errors.New("url scheme not found")
+		return &Error{Method: method, URL: location, Message: "url scheme not found", Kind: KindInvalidArgument}
 	}
 	if u.Path == "" {
-		return errors.New("url path not found")
+		return &Error{Method: method, URL: location, Message: "url path not found", Kind: KindInvalidArgument}
 	}
 
 	// Validate connection
 	if rt.scheme != "" && rt.scheme != u.Scheme {
-		return fmt.Errorf("bad url scheme: %s != %s", rt.scheme, u.Scheme)
-	}
-	if rt.scheme == "" {
-		if err := rt.open(location); err != nil {
-			return err
-		}
-		rt.scheme = u.Scheme
+		return &Error{Method: method, URL: location, Message: fmt.Sprintf("bad url scheme: %s != %s", rt.scheme, u.Scheme), Kind: KindInvalidArgument}
 	}
 
 	// JSON Request
-	request := struct {
-		Method string `json:"method"`
-		URL    string `json:"url"`
-		Body   any    `json:"body"`
-	}{
+	request := agentRequest{
 		Method: method,
-		URL:    location,
+		URL:    requestURL(location, u),
 		Body:   body,
 	}
-	if err := rt.encode(&request); err != nil {
-		rt.close()
-		return err
-	}
 
 	// JSON Response
-	var responseMessage json.RawMessage
-	if err := rt.decode(&responseMessage); err != nil {
-		rt.close()
-		return err
+	start := time.Now()
+	responseMessage, err := rt.send(ctx, location, u, &request)
+	rt.watcher.record(start, method, location, body, responseMessage, err)
+	if err != nil {
+		return transportError(method, location, err)
 	}
 
 	// Check for error
+	if err := decodeResponse(method, location, responseMessage, response); err != nil {
+		return err
+	}
+
+	// Shared packets hold a reference on the connection until released
+	if worker, ok := response.(*Worker); ok {
+		for i := range worker.Packets {
+			if worker.Packets[i].Ref != "" {
+				worker.Packets[i].roundTripper = rt
+				worker.Packets[i].gen = rt.gen
+				rt.ref++
+			}
+		}
+	}
+
+	// Done
+	return nil
+}
+
+// Url sent to the agent, without the dial parameters, eg the device of a
+// UART url
+func requestURL(location string, u *url.URL) string {
+	q := u.Query()
+	if u.Scheme != "uart" || !q.Has("device") {
+		return location
+	}
+	q.Del("device")
+	v := *u
+	v.RawQuery = q.Encode()
+	return v.String()
+}
+
+// Send a request, dialing as needed. Requests lost with the connection are
+// replayed on a new one when idempotent.
+func (rt *roundTripper) send(ctx context.Context, location string, u *url.URL, request *agentRequest) (json.RawMessage, error) {
+	method := request.Method
+	for retry := 0; ; retry++ {
+		if rt.scheme == "" {
+			if err := rt.connect(ctx, location, u); err != nil {
+				return nil, err
+			}
+		}
+		responseMessage, err := rt.exchange(ctx, request)
+		if err == nil {
+			return responseMessage, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		// Only idempotent requests are replayed on a new connection, others
+		// may have been processed by the agent
+		if method != "GET" {
+			return nil, fmt.Errorf("%s %s not replayed after connection loss: %w", method, location, err)
+		}
+		if retry >= rt.watcher.policy().Retries {
+			return nil, err
+		}
+	}
+}
+
+// Agent response, checked for error strings then parsed into response
+func decodeResponse(method, location string, responseMessage json.RawMessage, response any) error {
 	responseError := struct {
 		Location string `json:"location"`
 		Error    string `json:"error"`
@@ -284,28 +535,74 @@ func (rt *roundTripper) Call(method, location string, body, response any) error
 	if err := json.Unmarshal(responseMessage, &responseError); err != nil {
 		return err
 	}
-	switch responseError.Error {
-	case "":
-		// No error
-	case EOF.Error():
-		return EOF
-	case ErrRedirect.Error():
-		return fmt.Errorf("%w: %s", ErrRedirect, responseError.Location)
-	case ErrUpdating.Error():
-		return ErrUpdating
-	case ErrClosed.Error():
-		return ErrClosed
-	default:
-		return errors.New(responseError.Error)
+	if responseError.Error != "" {
+		return agentError(method, location, responseError.Error, responseError.Location)
 	}
 
 	// Parse response
 	if response != nil {
-		return json.Unmarshal(responseMessage, response)
+		if err := json.Unmarshal(responseMessage, response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deadline in the past, used to interrupt pending reads and writes
+var aLongTimeAgo = time.Unix(1, 0)
+
+// Send one request and read its response within the context bounds. An
+// interrupted exchange leaves unread bytes on the wire, so the connection is
+// dropped and the next call dials again.
+func (rt *roundTripper) exchange(ctx context.Context, request any) (json.RawMessage, error) {
+	conn := rt.conn
+
+	// Bound the exchange, connections without deadlines are closed instead
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil && !errors.Is(err, os.ErrNoDeadline) {
+			rt.drop()
+			return nil, err
+		}
+	}
+	stop := context.AfterFunc(ctx, func() {
+		if err := conn.SetDeadline(aLongTimeAgo); err != nil {
+			conn.Close()
+		}
+	})
+
+	// Request / Response
+	var responseMessage json.RawMessage
+	err := rt.encode(request)
+	if err == nil {
+		err = rt.decode(&responseMessage)
+	}
+
+	// Interrupted
+	if !stop() {
+		rt.drop()
+		if err == nil {
+			return responseMessage, nil
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			rt.drop()
+			return nil, context.DeadlineExceeded
+		}
+		rt.lost(err)
+		return nil, err
+	}
+
+	// Clear deadline
+	if _, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(time.Time{}); err != nil && !errors.Is(err, os.ErrNoDeadline) {
+			rt.drop()
+		}
 	}
 
 	// Done
-	return nil
+	return responseMessage, nil
 }
 
 //
@@ -313,53 +610,90 @@ func (rt *roundTripper) Call(method, location string, body, response any) error
 //
 
 func Get(url string, response any) error {
+	return GetContext(context.Background(), url, response)
+}
+
+func Post(url string, body, response any) error {
+	return PostContext(context.Background(), url, body, response)
+}
+
+func Delete(url string) (err error) {
+	return DeleteContext(context.Background(), url)
+}
+
+func GetContext(ctx context.Context, url string, response any) error {
 	var client Client
 	defer client.Close()
-	return client.Get(url, response)
+	return client.GetContext(ctx, url, response)
 }
 
-func Post(url string, body, response any) error {
+func PostContext(ctx context.Context, url string, body, response any) error {
 	var client Client
 	defer client.Close()
-	return client.Post(url, body, response)
+	return client.PostContext(ctx, url, body, response)
 }
 
-func Delete(url string) (err error) {
+func DeleteContext(ctx context.Context, url string) error {
 	var client Client
 	defer client.Close()
-	return client.Delete(url)
+	return client.DeleteContext(ctx, url)
 }
 
 type Client struct {
 	roundTripper roundTripper
+	pool         *pool
+	replay       *replayer
+	watcher      watcher
 }
 
 func (c *Client) Get(url string, response any) error {
-	if err := c.call("GET", url, nil, response); err != nil {
-		return err
-	}
-	if worker, ok := response.(*Worker); ok {
-		for i := range worker.Packets {
-			if worker.Packets[i].Ref != "" {
-				worker.Packets[i].roundTripper = c.roundTripper.Clone()
-			}
-		}
-	}
-	return nil
+	return c.GetContext(context.Background(), url, response)
 }
 
 func (c *Client) Post(url string, body, response any) error {
-	return c.call("POST", url, body, response)
+	return c.PostContext(context.Background(), url, body, response)
 }
 
 func (c *Client) Delete(url string) error {
-	return c.call("DELETE", url, nil, nil)
+	return c.DeleteContext(context.Background(), url)
+}
+
+// GetContext is like Get, the exchange is canceled or timed out with ctx
+func (c *Client) GetContext(ctx context.Context, url string, response any) error {
+	return c.call(ctx, "GET", url, nil, response)
+}
+
+// PostContext is like Post, the exchange is canceled or timed out with ctx
+func (c *Client) PostContext(ctx context.Context, url string, body, response any) error {
+	return c.call(ctx, "POST", url, body, response)
+}
+
+// DeleteContext is like Delete, the exchange is canceled or timed out with ctx
+func (c *Client) DeleteContext(ctx context.Context, url string) error {
+	return c.call(ctx, "DELETE", url, nil, nil)
 }
 
 func (c *Client) Close() error {
+	if c.pool != nil {
+		return c.pool.Close()
+	}
 	return c.roundTripper.Close()
 }
 
-func (c *Client) call(method, location string, body, response any) error {
-	return c.roundTripper.Call(method, location, body, response)
+func (c *Client) call(ctx context.Context, method, location string, body, response any) error {
+	if err := c.require(ctx, method, location, body); err != nil {
+		return err
+	}
+	return c.chain()(ctx, method, location, body, response)
+}
+
+// Innermost call of the chain
+func (c *Client) dispatch(ctx context.Context, method, location string, body, response any) error {
+	if c.replay != nil {
+		return c.replay.Call(ctx, method, location, body, response)
+	}
+	if c.pool != nil {
+		return c.pool.Call(ctx, method, location, body, response)
+	}
+	return c.roundTripper.CallContext(ctx, method, location, body, response)
 }
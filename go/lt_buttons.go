@@ -0,0 +1,237 @@
+package lt
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// Button events
+//
+
+type ButtonEventType int
+
+const (
+	ButtonDown        ButtonEventType = iota
+	ButtonUp                          // Duration holds the press duration
+	ButtonClick                       // Short press, not followed by a second one
+	ButtonLongPress                   // Held for LongPress, no click follows
+	ButtonDoubleClick                 // Two short presses within DoubleClick
+)
+
+func (t ButtonEventType) String() string {
+	switch t {
+	case ButtonDown:
+		return "down"
+	case ButtonUp:
+		return "up"
+	case ButtonClick:
+		return "click"
+	case ButtonLongPress:
+		return "long-press"
+	case ButtonDoubleClick:
+		return "double-click"
+	default:
+		return "unknown"
+	}
+}
+
+type ButtonEvent struct {
+	Button    int // Index in the buttons list, or pin of a single button url
+	Type      ButtonEventType
+	Time      time.Time     // Detection time
+	Timestamp int64         // Agent timestamp of the last press or release, in microseconds
+	Duration  time.Duration // Press duration of ButtonUp and ButtonLongPress
+}
+
+type ButtonOptions struct {
+	Client      ContextCaller // Client polling the agent, a private one by default
+	Interval    time.Duration // Poll interval, 50ms by default
+	LongPress   time.Duration // Long press duration, 800ms by default
+	DoubleClick time.Duration // Double click window, 300ms by default, negative to disable
+	OnError     func(error)   // Poll errors, the watcher keeps polling
+}
+
+func (o ButtonOptions) withDefaults() ButtonOptions {
+	if o.Interval <= 0 {
+		o.Interval = 50 * time.Millisecond
+	}
+	if o.LongPress <= 0 {
+		o.LongPress = 800 * time.Millisecond
+	}
+	if o.DoubleClick == 0 {
+		o.DoubleClick = 300 * time.Millisecond
+	}
+	return o
+}
+
+// WatchButtons polls the buttons of a board or camera head, eg
+// "cv40:/0/camera/0/buttons" or a single "cv40:/0/buttons/1", and sends their
+// events until ctx is done. Presses between polls are recovered from the
+// pressed counts and timestamps. Clicks are sent once the double click window
+// expires, so click, long press and double click exclude each other.
+func WatchButtons(ctx context.Context, url string, opts ButtonOptions) (<-chan ButtonEvent, error) {
+	opts = opts.withDefaults()
+	var client *Client
+	if opts.Client == nil {
+		client = &Client{}
+		opts.Client = client
+	}
+	w := &buttonWatcher{url: url, opts: opts, states: map[int]*buttonState{}}
+	if pin, err := strconv.Atoi(path.Base(url)); err == nil && strings.Contains(url, "/buttons/") {
+		w.single, w.pin = true, pin
+	}
+
+	// Initial state, held buttons are not reported
+	buttons, err := w.poll(ctx)
+	if err != nil {
+		if client != nil {
+			client.Close()
+		}
+		return nil, err
+	}
+	for i, b := range buttons {
+		w.states[i] = &buttonState{pressed: b.Pressed, count: b.PressedCount, ts: b.Timestamp, down: time.Now(), long: b.Pressed}
+	}
+
+	events := make(chan ButtonEvent, 16)
+	go func() {
+		defer close(events)
+		if client != nil {
+			defer client.Close()
+		}
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			buttons, err := w.poll(ctx)
+			if err != nil {
+				if ctx.Err() == nil && opts.OnError != nil {
+					opts.OnError(err)
+				}
+				continue
+			}
+			for _, e := range w.update(buttons, time.Now()) {
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+type buttonWatcher struct {
+	url    string
+	opts   ButtonOptions
+	single bool
+	pin    int
+	states map[int]*buttonState
+}
+
+type buttonState struct {
+	pressed bool
+	count   int
+	ts      int64
+	down    time.Time // Press detection time
+	long    bool      // Long press sent for the current press
+	click   time.Time // Pending click, zero if none
+}
+
+func (w *buttonWatcher) poll(ctx context.Context) ([]Button, error) {
+	if w.single {
+		var b Button
+		err := w.opts.Client.GetContext(ctx, w.url, &b)
+		return []Button{b}, err
+	}
+	var b Buttons
+	err := w.opts.Client.GetContext(ctx, w.url, &b)
+	return b.Buttons, err
+}
+
+// Events of the polled buttons, in order per button
+func (w *buttonWatcher) update(buttons []Button, now time.Time) (events []ButtonEvent) {
+	for i, b := range buttons {
+		id := i
+		if w.single {
+			id = w.pin
+		}
+		st, ok := w.states[i]
+		if !ok {
+			st = &buttonState{}
+			w.states[i] = st
+		}
+		emit := func(t ButtonEventType, d time.Duration) {
+			events = append(events, ButtonEvent{Button: id, Type: t, Time: now, Timestamp: b.Timestamp, Duration: d})
+		}
+		down := func() {
+			emit(ButtonDown, 0)
+			st.down, st.long = now, false
+		}
+		up := func() {
+			d := now.Sub(st.down)
+			emit(ButtonUp, d)
+			switch {
+			case st.long:
+			case w.opts.DoubleClick < 0:
+				emit(ButtonClick, d)
+			case !st.click.IsZero() && now.Sub(st.click) <= w.opts.DoubleClick:
+				emit(ButtonDoubleClick, d)
+				st.click = time.Time{}
+			default:
+				st.click = now
+			}
+		}
+
+		// Expired click window, before the presses it does not pair with
+		if !st.click.IsZero() && now.Sub(st.click) > w.opts.DoubleClick {
+			emit(ButtonClick, 0)
+			st.click = time.Time{}
+		}
+
+		// Presses since the last poll, the count resets on release
+		presses := b.PressedCount - st.count
+		if b.PressedCount < st.count {
+			presses = b.PressedCount
+		}
+		if presses == 0 && b.Timestamp != st.ts && b.Pressed == st.pressed {
+			presses = 1 // A press and release in between
+		}
+		if presses == 0 && b.Pressed && !st.pressed {
+			presses = 1
+		}
+
+		// Release of the current press, missed presses, then the new one
+		if st.pressed && (!b.Pressed || presses > 0) {
+			up()
+		}
+		cycles := presses
+		if b.Pressed {
+			cycles--
+		}
+		for j := 0; j < cycles; j++ {
+			down()
+			up()
+		}
+		if b.Pressed && (!st.pressed || presses > 0) {
+			down()
+		}
+		st.pressed, st.count, st.ts = b.Pressed, b.PressedCount, b.Timestamp
+
+		// Long press while held
+		if st.pressed && !st.long && now.Sub(st.down) >= w.opts.LongPress {
+			emit(ButtonLongPress, now.Sub(st.down))
+			st.long = true
+		}
+	}
+	return events
+}
@@ -0,0 +1,92 @@
+package lt_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// Button of the fake agent, pressed and released like the agent reports it
+type fakeButton struct {
+	srv *lttest.Server
+	b   lt.Button
+}
+
+func (f *fakeButton) set(pressed bool, presses int) {
+	f.b.Pressed = pressed
+	f.b.PressedCount += presses
+	f.b.Timestamp = time.Now().UnixMicro()
+	f.srv.Set("/0/buttons", lt.Buttons{Buttons: []lt.Button{f.b}})
+}
+
+// A step holds a button state for a duration
+type step struct {
+	pressed bool
+	presses int // Presses since the previous step
+	hold    time.Duration
+}
+
+func press(d time.Duration) step   { return step{true, 1, d} }
+func release(d time.Duration) step { return step{false, 0, d} }
+
+func TestWatchButtons(t *testing.T) {
+	const (
+		longPress   = 300 * time.Millisecond
+		doubleClick = 200 * time.Millisecond
+	)
+	down, up, click, long, double := lt.ButtonDown, lt.ButtonUp, lt.ButtonClick, lt.ButtonLongPress, lt.ButtonDoubleClick
+	tests := []struct {
+		name  string
+		steps []step
+		want  []lt.ButtonEventType
+	}{
+		{"click", []step{press(50 * time.Millisecond), release(0)}, []lt.ButtonEventType{down, up, click}},
+		{"release before long press", []step{press(longPress - 100*time.Millisecond), release(0)}, []lt.ButtonEventType{down, up, click}},
+		{"release after long press", []step{press(longPress + 100*time.Millisecond), release(0)}, []lt.ButtonEventType{down, long, up}},
+		{"double click", []step{press(50 * time.Millisecond), release(50 * time.Millisecond), press(50 * time.Millisecond), release(0)},
+			[]lt.ButtonEventType{down, up, down, up, double}},
+		{"second press outside the window", []step{press(50 * time.Millisecond), release(doubleClick + 150*time.Millisecond), press(50 * time.Millisecond), release(0)},
+			[]lt.ButtonEventType{down, up, click, down, up, click}},
+		{"press between polls", []step{{false, 1, 0}}, []lt.ButtonEventType{down, up, click}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := lttest.NewServer()
+			defer srv.Close()
+			button := &fakeButton{srv: srv}
+			button.set(false, 0)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := lt.WatchButtons(ctx, srv.URL("/0/buttons"), lt.ButtonOptions{Interval: 10 * time.Millisecond, LongPress: longPress, DoubleClick: doubleClick})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.steps {
+				button.set(s.pressed, s.presses)
+				time.Sleep(s.hold)
+			}
+
+			// Pending clicks are sent once the window expires
+			var got []lt.ButtonEventType
+			timeout := time.After(doubleClick + 200*time.Millisecond)
+		collect:
+			for {
+				select {
+				case e := <-events:
+					got = append(got, e.Type)
+				case <-timeout:
+					break collect
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("events %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package lt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+//
+// Capture
+//
+
+// Capture line, one request/response pair per call
+type Capture struct {
+	Time     time.Time       `json:"time"`
+	Duration int64           `json:"duration"` // Microseconds
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"` // Transport error, agent errors are in the response
+}
+
+type capture struct {
+	encode func(any) error
+	mu     sync.Mutex
+}
+
+// Record writes every call of the client to w as JSONL captures, nil stops
+// recording. Shared memory packets are written inline as base64 data, write
+// errors are ignored.
+func (c *Client) Record(w io.Writer) {
+	c.watcher.mu.Lock()
+	if w == nil {
+		c.watcher.capture = nil
+	} else {
+		c.watcher.capture = &capture{encode: json.NewEncoder(w).Encode}
+	}
+	c.watcher.mu.Unlock()
+	c.bind()
+}
+
+func (w *watcher) record(start time.Time, method, location string, body any, responseMessage json.RawMessage, err error) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	cp := w.capture
+	w.mu.Unlock()
+	if cp == nil {
+		return
+	}
+
+	line := Capture{
+		Time:     start,
+		Duration: time.Since(start).Microseconds(),
+		Method:   method,
+		URL:      location,
+		Response: inline(responseMessage),
+	}
+	if body != nil {
+		line.Body, _ = json.Marshal(body)
+	}
+	if err != nil {
+		line.Error = err.Error()
+	}
+
+	cp.mu.Lock()
+	cp.encode(&line)
+	cp.mu.Unlock()
+}
+
+// Copy shared memory packets of a worker response into base64 data, the
+// references are dropped as they are meaningless outside the session
+func inline(responseMessage json.RawMessage) json.RawMessage {
+	var worker map[string]json.RawMessage
+	if json.Unmarshal(responseMessage, &worker) != nil {
+		return responseMessage
+	}
+	var packets []json.RawMessage
+	if json.Unmarshal(worker["packets"], &packets) != nil {
+		return responseMessage
+	}
+
+	shared := false
+	for i := range packets {
+		pkt := struct {
+			Ref    string `json:"ref"`
+			Handle string `json:"handle"`
+			Ptr    int    `json:"ptr"`
+			Len    int    `json:"len"`
+			Cap    int    `json:"cap"`
+		}{}
+		var packet map[string]json.RawMessage
+		if json.Unmarshal(packets[i], &pkt) != nil || pkt.Ref == "" || json.Unmarshal(packets[i], &packet) != nil {
+			continue
+		}
+		shared = true
+		var data []byte
+		if b, ok := sharedBuffers.Load(pkt.Handle, pkt.Cap); ok {
+			data = append([]byte(nil), b.Data[pkt.Ptr:pkt.Ptr+pkt.Len]...)
+			sharedBuffers.Delete(pkt.Handle)
+		}
+		for _, k := range []string{"ref", "handle", "ptr", "len", "cap"} {
+			delete(packet, k)
+		}
+		packet["data"] = mustMarshal(data)
+		packets[i] = mustMarshal(packet)
+	}
+	if !shared {
+		return responseMessage
+	}
+	worker["packets"] = mustMarshal(packets)
+	return mustMarshal(worker)
+}
+
+func mustMarshal(v any) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+//
+// Replay
+//
+
+// ErrNotCaptured is returned by replay clients for calls missing from the capture
+var ErrNotCaptured = errors.New("call not captured")
+
+// Replay options
+type ReplayConfig struct {
+	Realtime bool // Calls take their captured duration, otherwise they answer at once
+}
+
+// NewReplayClient returns a client answering calls from a capture written by
+// Record, without connecting to any agent. Each call consumes the first unused
+// capture of the same method and url, so concurrent callers stay deterministic
+// as long as each replays its own calls in order.
+func NewReplayClient(r io.Reader, config ReplayConfig) (*Client, error) {
+	rp := &replayer{config: config}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line Capture
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("capture line %d: %w", len(rp.captures)+1, err)
+		}
+		rp.captures = append(rp.captures, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	rp.used = make([]bool, len(rp.captures))
+	return &Client{replay: rp}, nil
+}
+
+type replayer struct {
+	config   ReplayConfig
+	captures []Capture
+	used     []bool
+	next     int // First unused capture
+	mu       sync.Mutex
+}
+
+func (rp *replayer) Call(ctx context.Context, method, location string, body, response any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	line, ok := rp.take(method, location)
+	if !ok {
+		return fmt.Errorf("%w: %s %s", ErrNotCaptured, method, location)
+	}
+
+	if rp.config.Realtime && line.Duration > 0 {
+		timer := time.NewTimer(time.Duration(line.Duration) * time.Microsecond)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	// Transport errors
+	switch line.Error {
+	case "":
+	case context.DeadlineExceeded.Error():
+		return transportError(method, location, context.DeadlineExceeded)
+	case context.Canceled.Error():
+		return transportError(method, location, context.Canceled)
+	default:
+		return transportError(method, location, errors.New(line.Error))
+	}
+	return decodeResponse(method, location, line.Response, response)
+}
+
+func (rp *replayer) take(method, location string) (Capture, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	for i := rp.next; i < len(rp.captures); i++ {
+		if rp.used[i] || rp.captures[i].Method != method || rp.captures[i].URL != location {
+			continue
+		}
+		rp.used[i] = true
+		for rp.next < len(rp.used) && rp.used[rp.next] {
+			rp.next++
+		}
+		return rp.captures[i], true
+	}
+	return Capture{}, false
+}
@@ -0,0 +1,81 @@
+package lt_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// A replay client answers the captured calls like the agent did
+func TestCaptureReplay(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	srv.OnWorker(func(w *lttest.Worker) {
+		go func() {
+			w.Push(lttest.Packet{Data: []byte("frame")})
+			w.End()
+		}()
+	})
+	var client lt.Client
+	defer client.Close()
+	var capture bytes.Buffer
+	client.Record(&capture)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var camera lt.Camera
+	if err := client.GetContext(ctx, srv.URL("/0/camera/0"), &camera); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.GetContext(ctx, srv.URL("/0/nothing"), nil); lt.ErrorKindOf(err) != lt.KindNotFound {
+		t.Fatalf("get of a missing resource: %v", err)
+	}
+	h, err := lt.CreateDataWorker(ctx, &client, srv.URL("/0/camera/0"), lt.ImageDataWorker{Media: "image/yuv422"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	client.Record(nil)
+
+	replay, err := lt.NewReplayClient(&capture, lt.ReplayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	var replayed lt.Camera
+	if err := replay.GetContext(ctx, srv.URL("/0/camera/0"), &replayed); err != nil {
+		t.Fatal(err)
+	}
+	if replayed != camera {
+		t.Errorf("replayed camera %+v, want %+v", replayed, camera)
+	}
+	if err := replay.GetContext(ctx, srv.URL("/0/nothing"), nil); lt.ErrorKindOf(err) != lt.KindNotFound {
+		t.Errorf("replayed missing resource: %v, want not found", err)
+	}
+	h, err = lt.CreateDataWorker(ctx, replay, srv.URL("/0/camera/0"), lt.ImageDataWorker{Media: "image/yuv422"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets []string
+	for p, err := range h.Packets(ctx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, string(p.Data))
+	}
+	if len(packets) != 1 || packets[0] != "frame" {
+		t.Errorf("replayed packets %q, want frame", packets)
+	}
+
+	// Calls beyond the capture
+	if err := replay.GetContext(ctx, srv.URL("/0/camera/0"), nil); !errors.Is(err, lt.ErrNotCaptured) {
+		t.Errorf("call beyond the capture: %v, want ErrNotCaptured", err)
+	}
+}
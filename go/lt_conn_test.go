@@ -0,0 +1,46 @@
+package lt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Connection without deadlines, eg a Windows pipe, counting its closes
+type pipeLike struct {
+	net.Conn
+	closes atomic.Int32
+}
+
+func (c *pipeLike) Close() error {
+	if c.closes.Add(1) > 1 {
+		return errors.New("closed twice")
+	}
+	return c.Conn.Close()
+}
+
+func (c *pipeLike) SetDeadline(time.Time) error { return os.ErrNoDeadline }
+
+// A cancelled exchange closes a connection without deadlines once
+func TestExchangeCancelNoDeadline(t *testing.T) {
+	client, agent := net.Pipe()
+	defer agent.Close()
+	go io.Copy(io.Discard, agent) // The agent never answers
+	conn := &pipeLike{Conn: client}
+	var rt roundTripper
+	rt.use(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := rt.exchange(ctx, JSON{"method": "GET"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("exchange: %v, want DeadlineExceeded", err)
+	}
+	if n := conn.closes.Load(); n != 1 {
+		t.Errorf("connection closed %d times, want once", n)
+	}
+}
@@ -0,0 +1,78 @@
+package lt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sync"
+)
+
+//
+// Dialers
+//
+
+// DialFunc opens a connection to the agent of a url. Connections without
+// deadlines are closed instead when a call is canceled.
+type DialFunc func(ctx context.Context, u *url.URL) (net.Conn, error)
+
+var dialers = struct {
+	m  map[string]DialFunc
+	mu sync.RWMutex
+}{
+	m: map[string]DialFunc{},
+}
+
+// Built-in schemes, other schemes name a local agent socket
+func init() {
+	RegisterDialer("uart", dialUART)
+	RegisterDialer("tcp", dialTCP)
+	RegisterDialer("", dialLocal)
+}
+
+// RegisterDialer sets the dialer of a url scheme, eg a TLS "tls" scheme or an
+// in-memory pipe for tests. The "" scheme sets the fallback of unregistered
+// schemes, a local socket named after the scheme by default. Connections
+// already open are not affected.
+func RegisterDialer(scheme string, dial DialFunc) {
+	dialers.mu.Lock()
+	defer dialers.mu.Unlock()
+	if dial == nil {
+		delete(dialers.m, scheme)
+		return
+	}
+	dialers.m[scheme] = dial
+}
+
+// UnixDialer dials "<dir>/<scheme>.sock", for agents serving their socket out
+// of os.TempDir()
+func UnixDialer(dir string) DialFunc {
+	return func(ctx context.Context, u *url.URL) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", path.Join(dir, u.Scheme+".sock"))
+	}
+}
+
+func dial(ctx context.Context, addr string) (net.Conn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dialers.mu.RLock()
+	dial, ok := dialers.m[u.Scheme]
+	if !ok {
+		dial, ok = dialers.m[""]
+	}
+	dialers.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no dialer for scheme: %s", u.Scheme)
+	}
+	return dial(ctx, u)
+}
+
+func dialTCP(ctx context.Context, u *url.URL) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", u.Host)
+}
@@ -0,0 +1,152 @@
+package lt
+
+import (
+	"context"
+	"strconv"
+)
+
+//
+// Device discovery
+//
+
+// Inventory of the boards of an agent, their cameras, buttons and outputs
+type Inventory struct {
+	Agent    string      `json:"agent"` // Agent root, eg "cv40:/"
+	Version  string      `json:"version"`
+	Revision string      `json:"revision"`
+	Boards   []BoardInfo `json:"boards"`
+}
+
+type BoardInfo struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+	Board
+	Buttons []Button     `json:"buttons"`
+	Cameras []CameraInfo `json:"cameras"`
+	Outputs []OutputInfo `json:"outputs"`
+}
+
+type CameraInfo struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+	Camera
+	Buttons []Button `json:"buttons"`
+}
+
+type OutputInfo struct {
+	Name string `json:"name"` // Board relative path, eg "hdmi-out/0"
+	URL  string `json:"url"`
+	Output
+}
+
+// Board returns the board of an id
+func (inv Inventory) Board(id int) (BoardInfo, bool) {
+	for _, b := range inv.Boards {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return BoardInfo{}, false
+}
+
+// Camera returns the camera of an id
+func (b BoardInfo) Camera(id int) (CameraInfo, bool) {
+	for _, c := range b.Cameras {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return CameraInfo{}, false
+}
+
+// Output returns the output of a board relative path, eg "hdmi-out/0"
+func (b BoardInfo) Output(name string) (OutputInfo, bool) {
+	for _, o := range b.Outputs {
+		if o.Name == name {
+			return o, true
+		}
+	}
+	return OutputInfo{}, false
+}
+
+// Ids probed per board, camera and output kind: probing stops at the first
+// missing id
+const discoverMaxID = 8
+
+// Discover walks the resources of an agent, eg "cv40" or
+// "tcp://10.0.0.2:8080", and returns its inventory. Missing resources end the
+// walk of their kind, other errors fail it. A nil c uses a private client.
+func Discover(ctx context.Context, c ContextCaller, agent string) (Inventory, error) {
+	ctx = ContextExpecting(ctx, KindNotFound)
+	if c == nil {
+		client := &Client{}
+		defer client.Close()
+		c = client
+	}
+	root := At(agent)
+	a, err := root.GetContext(ctx, c)
+	if err != nil {
+		return Inventory{}, err
+	}
+	inv := Inventory{Agent: root.URL(), Version: a.Version, Revision: a.Revision, Boards: []BoardInfo{}}
+
+	for id := 0; id < discoverMaxID; id++ {
+		p := root.Board(id)
+		board, err := p.GetContext(ctx, c)
+		if ErrorKindOf(err) == KindNotFound {
+			break
+		}
+		if err != nil {
+			return inv, err
+		}
+		b := BoardInfo{ID: id, URL: p.URL(), Board: board, Cameras: []CameraInfo{}, Outputs: []OutputInfo{}}
+		if b.Buttons, err = discoverButtons(ctx, c, p.Buttons()); err != nil {
+			return inv, err
+		}
+
+		for id := 0; id < discoverMaxID; id++ {
+			cp := p.Camera(id)
+			camera, err := cp.GetContext(ctx, c)
+			if ErrorKindOf(err) == KindNotFound {
+				break
+			}
+			if err != nil {
+				return inv, err
+			}
+			info := CameraInfo{ID: id, URL: cp.URL(), Camera: camera}
+			if info.Buttons, err = discoverButtons(ctx, c, cp.Buttons()); err != nil {
+				return inv, err
+			}
+			b.Cameras = append(b.Cameras, info)
+		}
+
+		for _, kind := range []string{"hdmi-out", "sdi-out"} {
+			for id := 0; id < discoverMaxID; id++ {
+				name := kind + "/" + strconv.Itoa(id)
+				op := p.Output(name)
+				output, err := op.GetContext(ctx, c)
+				if ErrorKindOf(err) == KindNotFound {
+					break
+				}
+				if err != nil {
+					return inv, err
+				}
+				b.Outputs = append(b.Outputs, OutputInfo{Name: name, URL: op.URL(), Output: output})
+			}
+		}
+		inv.Boards = append(inv.Boards, b)
+	}
+	return inv, nil
+}
+
+// Buttons of a board or camera head, none if missing
+func discoverButtons(ctx context.Context, c ContextCaller, g Getter[Buttons]) ([]Button, error) {
+	buttons, err := g.GetContext(ctx, c)
+	if ErrorKindOf(err) == KindNotFound {
+		return []Button{}, nil
+	}
+	if buttons.Buttons == nil {
+		buttons.Buttons = []Button{}
+	}
+	return buttons.Buttons, err
+}
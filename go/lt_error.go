@@ -0,0 +1,148 @@
+package lt
+
+import (
+	"errors"
+	"strings"
+)
+
+//
+// Agent errors
+//
+
+type ErrorKind int
+
+const (
+	KindOther           ErrorKind = iota // Unclassified agent error
+	KindNotFound                         // Unknown resource or worker
+	KindInvalidArgument                  // Rejected url or body
+	KindBusy                             // Resource in use
+	KindUpdating                         // Agent updating, retry later
+	KindClosed                           // Agent connection closed
+	KindTransport                        // Connection, deadline or cancellation
+	KindEOF                              // End of a worker stream
+	KindRedirect                         // Worker created at Location
+	KindUnsupported                      // Feature missing from the agent version
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not-found"
+	case KindInvalidArgument:
+		return "invalid-argument"
+	case KindBusy:
+		return "busy"
+	case KindUpdating:
+		return "updating"
+	case KindClosed:
+		return "closed"
+	case KindTransport:
+		return "transport"
+	case KindEOF:
+		return "eof"
+	case KindRedirect:
+		return "redirect"
+	case KindUnsupported:
+		return "unsupported"
+	default:
+		return "other"
+	}
+}
+
+// Error of a call, answered by the agent or raised by the transport. It
+// matches the EOF, ErrRedirect, ErrUpdating, ErrClosed and ErrUnsupported
+// sentinels with errors.Is, transport and unsupported causes are unwrapped.
+type Error struct {
+	Method   string
+	URL      string
+	Message  string // Agent error string, or transport error
+	Kind     ErrorKind
+	Location string // Redirect location
+	Err      error  // Transport cause, or *UnsupportedError
+}
+
+func (e *Error) Error() string {
+	msg := e.Method + " " + e.URL + ": " + e.Message
+	if e.Kind == KindRedirect {
+		msg += ": " + e.Location
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case EOF:
+		return e.Kind == KindEOF
+	case ErrRedirect:
+		return e.Kind == KindRedirect
+	case ErrUpdating:
+		return e.Kind == KindUpdating
+	case ErrClosed:
+		return e.Kind == KindClosed
+	case ErrUnsupported:
+		return e.Kind == KindUnsupported
+	}
+	return false
+}
+
+// ErrorKindOf returns the kind of a call error, KindOther for foreign errors
+func ErrorKindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindOther
+}
+
+// RedirectLocation returns the worker location of an ErrRedirect error
+func RedirectLocation(err error) string {
+	var e *Error
+	if errors.As(err, &e) && e.Kind == KindRedirect {
+		return e.Location
+	}
+	return ""
+}
+
+// Agent error strings
+func agentError(method, location, message, redirect string) *Error {
+	e := &Error{Method: method, URL: location, Message: message, Location: redirect}
+	lower := strings.ToLower(message)
+	switch {
+	case message == EOF.Error():
+		e.Kind = KindEOF
+	case message == ErrRedirect.Error():
+		e.Kind = KindRedirect
+	case message == ErrUpdating.Error():
+		e.Kind = KindUpdating
+	case message == ErrClosed.Error():
+		e.Kind = KindClosed
+	case containsAny(lower, "not found", "no such", "unknown", "does not exist"):
+		e.Kind = KindNotFound
+	case containsAny(lower, "invalid", "out of range", "unsupported", "missing", "bad "):
+		e.Kind = KindInvalidArgument
+	case containsAny(lower, "busy", "in use", "already"):
+		e.Kind = KindBusy
+	}
+	return e
+}
+
+func transportError(method, location string, err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Method: method, URL: location, Message: err.Error(), Kind: KindTransport, Err: err}
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
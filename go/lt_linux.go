@@ -1,16 +1,16 @@
 package lt
 
 import (
+	"container/list"
+	"context"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
-	"path"
 	"strconv"
 	"syscall"
 	"time"
 
-	"github.com/tarm/serial"
 	"golang.org/x/sys/unix"
 )
 
@@ -18,65 +18,156 @@ import (
 // Conn
 //
 
-func dial(addr string) (net.Conn, error) {
-	u, err := url.Parse(addr)
-	if err != nil {
-		return nil, err
-	}
-
-	switch u.Scheme {
-	// UART
-	case "uart":
-		port := u.Hostname()
-		baudrate := 115200
-		if u.Port() != "" {
-			if baudrate, err = strconv.Atoi(u.Port()); err != nil {
-				return nil, fmt.Errorf("invalid baudrate: %s %w", u.Port(), err)
-			}
-		}
-		uart, err := serial.OpenPort(&serial.Config{Name: "TTY" + port, Baud: baudrate})
-		if err != nil {
-			return nil, fmt.Errorf("uart error: %s %s %d %w", u.Scheme, port, baudrate, err)
+// Baudrate as url port, eg "uart://ttyUSB0:115200"
+func dialUART(ctx context.Context, u *url.URL) (net.Conn, error) {
+	var err error
+	baudrate := 115200
+	if u.Port() != "" {
+		if baudrate, err = strconv.Atoi(u.Port()); err != nil {
+			return nil, fmt.Errorf("invalid baudrate: %s %w", u.Port(), err)
 		}
-		return &UARTConn{uart}, nil
+	}
+	device := u.Query().Get("device")
+	if device == "" {
+		device = uartDevice(u.Hostname())
+	}
+	return OpenUART(device, baudrate)
+}
 
-	// TCP
-	case "tcp":
-		return net.Dial("tcp", u.Host)
+// Unix socket named after the scheme
+func dialLocal(ctx context.Context, u *url.URL) (net.Conn, error) {
+	return UnixDialer(os.TempDir())(ctx, u)
+}
 
-	// Unix
-	default:
-		return net.Dial("unix", path.Join(os.TempDir(), u.Scheme+".sock"))
+// Device of a uart url host: a port number (ttyUSB0), a name under /dev or a
+// /dev/serial/by-id or by-path link. Full paths are given with a device query
+// parameter, eg "uart://pty:115200/0?device=/dev/pts/3", not sent to the
+// agent.
+func uartDevice(host string) string {
+	if _, err := strconv.Atoi(host); err == nil {
+		return "/dev/ttyUSB" + host
+	}
+	for _, dir := range []string{"/dev/", "/dev/serial/by-id/", "/dev/serial/by-path/"} {
+		if _, err := os.Stat(dir + host); err == nil {
+			return dir + host
+		}
 	}
+	return "/dev/" + host
+}
+
+var baudrates = map[int]uint32{
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	500000:  unix.B500000,
+	576000:  unix.B576000,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	1500000: unix.B1500000,
+	2000000: unix.B2000000,
+	3000000: unix.B3000000,
+	4000000: unix.B4000000,
 }
 
+// UART connection in raw mode. The device is non-blocking, so read and write
+// deadlines are served by the runtime poller.
 type UARTConn struct {
-	*serial.Port
+	file *os.File
+	addr uartAddr
+}
+
+// OpenUART opens a serial device, or a pseudo-terminal, in raw 8N1 mode
+func OpenUART(device string, baudrate int) (*UARTConn, error) {
+	speed, ok := baudrates[baudrate]
+	if !ok {
+		return nil, fmt.Errorf("uart error: %s unsupported baudrate %d", device, baudrate)
+	}
+	file, err := os.OpenFile(device, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("uart error: %w", err)
+	}
+	raw, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("uart error: %w", err)
+	}
+	var terr error
+	raw.Control(func(fd uintptr) {
+		terr = configureUART(int(fd), speed)
+	})
+	if terr != nil {
+		file.Close()
+		return nil, &os.PathError{Op: "termios", Path: device, Err: terr}
+	}
+	return &UARTConn{file: file, addr: uartAddr(device)}, nil
+}
+
+func configureUART(fd int, speed uint32) error {
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF | unix.IXANY
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+	t.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL | speed
+	t.Ispeed = speed
+	t.Ospeed = speed
+	// Reads return as soon as a byte is available, deadlines bound the wait
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, t); err != nil {
+		return err
+	}
+	// Discard bytes left by a previous connection
+	return unix.IoctlSetInt(fd, unix.TCFLSH, unix.TCIOFLUSH)
+}
+
+func (uart *UARTConn) Read(b []byte) (n int, err error) {
+	return uart.file.Read(b)
 }
 
-//func (uart *UARTConn) Read(b []byte) (n int, err error)
-//func (uart *UARTConn) Write(b []byte) (n int, err error)
-//func (uart *UARTConn) Close() error
+func (uart *UARTConn) Write(b []byte) (n int, err error) {
+	return uart.file.Write(b)
+}
+
+func (uart *UARTConn) Close() error {
+	return uart.file.Close()
+}
 
 func (uart *UARTConn) LocalAddr() net.Addr {
-	return nil
+	return uart.addr
 }
 
 func (uart *UARTConn) RemoteAddr() net.Addr {
-	return nil
+	return uart.addr
 }
 
 func (uart *UARTConn) SetDeadline(t time.Time) error {
-	return nil
+	return uart.file.SetDeadline(t)
 }
 
 func (uart *UARTConn) SetReadDeadline(t time.Time) error {
-	return nil
-
+	return uart.file.SetReadDeadline(t)
 }
 
 func (uart *UARTConn) SetWriteDeadline(t time.Time) error {
-	return nil
+	return uart.file.SetWriteDeadline(t)
+}
+
+type uartAddr string
+
+func (a uartAddr) Network() string {
+	return "uart"
+}
+
+func (a uartAddr) String() string {
+	return string(a)
 }
 
 //
@@ -88,6 +179,10 @@ type buffer struct {
 	fd   int
 	Data []byte
 	ref  int
+
+	// Shared buffers cache
+	key  string
+	elem *list.Element
 }
 
 const shmPath = "/dev/shm/"
@@ -133,10 +228,12 @@ func (b *buffer) Close() error {
 	// Unmap memory
 	if b.Data != nil {
 		syscall.Munmap(b.Data)
+		b.Data = nil
 	}
 	// Close file descriptor
 	if b.fd >= 0 {
 		syscall.Close(b.fd)
+		b.fd = -1
 	}
 
 	return nil
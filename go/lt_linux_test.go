@@ -0,0 +1,113 @@
+package lt
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Pseudo-terminal pair: the agent side and the UART opened on the other end
+func openPTY(t *testing.T) (*os.File, *UARTConn) {
+	t.Helper()
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Skip("no pseudo-terminal:", err)
+	}
+	agent := os.NewFile(uintptr(fd), "/dev/ptmx")
+	t.Cleanup(func() { agent.Close() })
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal("unlockpt:", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal("ptsname:", err)
+	}
+	uart, err := OpenUART("/dev/pts/"+strconv.Itoa(n), 115200)
+	if err != nil {
+		t.Skip("pseudo-terminal not available:", err)
+	}
+	t.Cleanup(func() { uart.Close() })
+	return agent, uart
+}
+
+func TestUARTReadDeadline(t *testing.T) {
+	_, uart := openPTY(t)
+	if err := uart.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err := uart.Read(make([]byte, 16))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("read without data: %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("read returned after %v, deadline 100ms", elapsed)
+	}
+}
+
+// Noise and garbled lines before a response are skipped
+func TestUARTFrameResync(t *testing.T) {
+	agent, uart := openPTY(t)
+	go agent.Write([]byte("\x00\xff boot noise\n{\"garbled\": tru\nxx{\"status\": \"ok\"}\n"))
+
+	if err := uart.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Status string `json:"status"`
+	}
+	if err := frameDecoder(uart)(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Status != "ok" {
+		t.Errorf("decoded %+v, want status ok", v)
+	}
+}
+
+// Calls over a UART url, the agent answering after some noise. The device
+// query is a dial parameter, not sent to the agent.
+func TestUARTCall(t *testing.T) {
+	agent, uart := openPTY(t)
+	device := uart.addr.String()
+	uart.Close()
+
+	go func() {
+		reader := bufio.NewReader(agent)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var request agentRequest
+			json.Unmarshal(line, &request)
+			agent.Write([]byte("noise\n{\"model\": \"CV40\", \"url\": " + strconv.Quote(request.URL) + "}\n"))
+		}
+	}()
+
+	var client Client
+	defer client.Close()
+	tests := []struct {
+		location, sent string
+	}{
+		{"uart://pty:115200/0/camera/0?device=" + device, "uart://pty:115200/0/camera/0"},
+		{"uart://pty:115200/0/camera/0/colors?device=" + device + "&fields=gamma", "uart://pty:115200/0/camera/0/colors?fields=gamma"},
+	}
+	for _, tt := range tests {
+		var response struct {
+			Model string `json:"model"`
+			URL   string `json:"url"`
+		}
+		if err := client.Get(tt.location, &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Model != "CV40" || response.URL != tt.sent {
+			t.Errorf("response %+v, want the agent to get %s", response, tt.sent)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package lt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Interceptors
+//
+
+// CallFunc performs an agent call
+type CallFunc func(ctx context.Context, method, url string, body, response any) error
+
+// Interceptor wraps the calls of a client, eg to log, measure or trace them
+type Interceptor func(next CallFunc) CallFunc
+
+// Use appends interceptors to the call chain of the client, the first one
+// being the outermost. Calls already running are not affected.
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.watcher.mu.Lock()
+	defer c.watcher.mu.Unlock()
+	c.watcher.interceptors = append(c.watcher.interceptors, interceptors...)
+	c.watcher.chain = nil
+}
+
+// Call chain, built on first use
+func (c *Client) chain() CallFunc {
+	c.watcher.mu.Lock()
+	defer c.watcher.mu.Unlock()
+	if c.watcher.chain == nil {
+		call := c.dispatch
+		for i := len(c.watcher.interceptors) - 1; i >= 0; i-- {
+			call = c.watcher.interceptors[i](call)
+		}
+		c.watcher.chain = call
+	}
+	return c.watcher.chain
+}
+
+// PathTemplate returns the path of a url with its numeric segments replaced by
+// ":id", eg "/:id/camera/:id/visuals" for "cv40:/0/camera/0/visuals"
+func PathTemplate(location string) string {
+	p := location
+	if u, err := url.Parse(location); err == nil {
+		p = u.Path
+	}
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		if s != "" && strings.Trim(s, "0123456789") == "" {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+type expectedKey struct{}
+
+// ContextExpecting returns a context whose calls answering errors of kinds
+// are not failures for the interceptors, eg probes expecting KindNotFound
+func ContextExpecting(ctx context.Context, kinds ...ErrorKind) context.Context {
+	if prev, ok := ctx.Value(expectedKey{}).([]ErrorKind); ok {
+		kinds = append(append([]ErrorKind(nil), prev...), kinds...)
+	}
+	return context.WithValue(ctx, expectedKey{}, kinds)
+}
+
+// EOF and redirects are protocol answers, not failures, nor expected errors
+func failed(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	kind := ErrorKindOf(err)
+	switch kind {
+	case KindEOF, KindRedirect:
+		return false
+	}
+	expected, _ := ctx.Value(expectedKey{}).([]ErrorKind)
+	return !slices.Contains(expected, kind)
+}
+
+//
+// Logging
+//
+
+// LogCalls logs each call with its duration, failures at warn level and the
+// other calls at debug level. A nil logger logs to slog.Default().
+func LogCalls(logger *slog.Logger) Interceptor {
+	return func(next CallFunc) CallFunc {
+		return func(ctx context.Context, method, location string, body, response any) error {
+			start := time.Now()
+			err := next(ctx, method, location, body, response)
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+			attrs := []slog.Attr{
+				slog.String("method", method),
+				slog.String("url", location),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if !failed(ctx, err) {
+				l.LogAttrs(ctx, slog.LevelDebug, "lt call", attrs...)
+				return err
+			}
+			attrs = append(attrs, slog.String("kind", ErrorKindOf(err).String()), slog.String("err", err.Error()))
+			l.LogAttrs(ctx, slog.LevelWarn, "lt call", attrs...)
+			return err
+		}
+	}
+}
+
+//
+// Latency histograms
+//
+
+// LatencyBuckets are the upper bounds of the latency histograms
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Histogram of the call durations of a method and path template
+type Histogram struct {
+	Method  string
+	Path    string          // Path template, eg "/:id/camera/:id"
+	Buckets []time.Duration // Upper bounds, LatencyBuckets
+	Counts  []uint64        // Calls per bucket, the last one counting the calls above the bounds
+	Count   uint64
+	Errors  uint64
+	Sum     time.Duration
+	Max     time.Duration
+}
+
+// Quantile returns the upper bound of the bucket holding the q quantile, Max
+// for the calls above the bounds
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	var n uint64
+	for i, c := range h.Counts {
+		n += c
+		if n > rank || n == h.Count {
+			if i < len(h.Buckets) {
+				return h.Buckets[i]
+			}
+			break
+		}
+	}
+	return h.Max
+}
+
+// Latency records histograms of the call durations per method and path
+// template, eg client.Use(latency.Interceptor())
+type Latency struct {
+	m  map[string]*Histogram
+	mu sync.Mutex
+}
+
+func NewLatency() *Latency {
+	return &Latency{m: map[string]*Histogram{}}
+}
+
+func (l *Latency) Interceptor() Interceptor {
+	return func(next CallFunc) CallFunc {
+		return func(ctx context.Context, method, location string, body, response any) error {
+			start := time.Now()
+			err := next(ctx, method, location, body, response)
+			l.observe(method, PathTemplate(location), time.Since(start), failed(ctx, err))
+			return err
+		}
+	}
+}
+
+func (l *Latency) observe(method, path string, d time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := method + " " + path
+	h, ok := l.m[key]
+	if !ok {
+		h = &Histogram{Method: method, Path: path, Buckets: LatencyBuckets, Counts: make([]uint64, len(LatencyBuckets)+1)}
+		l.m[key] = h
+	}
+	i := sort.Search(len(h.Buckets), func(i int) bool { return d <= h.Buckets[i] })
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	h.Max = max(h.Max, d)
+	if failed {
+		h.Errors++
+	}
+}
+
+// Histograms returns a copy of the histograms, sorted by path and method
+func (l *Latency) Histograms() []Histogram {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	histograms := make([]Histogram, 0, len(l.m))
+	for _, h := range l.m {
+		c := *h
+		c.Counts = append([]uint64(nil), h.Counts...)
+		histograms = append(histograms, c)
+	}
+	sort.Slice(histograms, func(i, j int) bool {
+		if histograms[i].Path != histograms[j].Path {
+			return histograms[i].Path < histograms[j].Path
+		}
+		return histograms[i].Method < histograms[j].Method
+	})
+	return histograms
+}
+
+//
+// Tracing
+//
+
+// Span of a call, in the OpenTelemetry model: trace and span IDs are hex, the
+// attributes carry the method, url, agent and error kind
+type Span struct {
+	Name       string // Method and path template, eg "GET /:id/camera/:id"
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Err        error
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context whose calls are traced as children of s,
+// eg the span of an HTTP request handled by the application
+func ContextWithSpan(ctx context.Context, s Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func SpanFromContext(ctx context.Context) (Span, bool) {
+	s, ok := ctx.Value(spanKey{}).(Span)
+	return s, ok
+}
+
+// Trace exports a span for each call, export may bridge to an OpenTelemetry
+// exporter. It runs on the calling goroutine once the call returns.
+func Trace(export func(Span)) Interceptor {
+	return func(next CallFunc) CallFunc {
+		return func(ctx context.Context, method, location string, body, response any) error {
+			span := Span{
+				Name:   method + " " + PathTemplate(location),
+				SpanID: randomID(8),
+				Start:  time.Now(),
+				Attributes: map[string]string{
+					"lt.method": method,
+					"lt.url":    location,
+				},
+			}
+			if u, err := url.Parse(location); err == nil {
+				span.Attributes["lt.agent"] = u.Scheme + ":" + u.Host
+			}
+			if parent, ok := SpanFromContext(ctx); ok {
+				span.TraceID = parent.TraceID
+				span.ParentID = parent.SpanID
+			} else {
+				span.TraceID = randomID(16)
+			}
+			err := next(ContextWithSpan(ctx, span), method, location, body, response)
+			span.End = time.Now()
+			if failed(ctx, err) {
+				span.Err = err
+				span.Attributes["lt.error.kind"] = ErrorKindOf(err).String()
+			}
+			export(span)
+			return err
+		}
+	}
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,265 @@
+package lt
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//
+// Resource navigator
+//
+
+// Caller is implemented by Client
+type Caller interface {
+	Get(url string, response any) error
+	Post(url string, body, response any) error
+	Delete(url string) error
+}
+
+// ContextCaller is implemented by Client
+type ContextCaller interface {
+	GetContext(ctx context.Context, url string, response any) error
+	PostContext(ctx context.Context, url string, body, response any) error
+	DeleteContext(ctx context.Context, url string) error
+}
+
+// Getter is a resource answering GET with T
+type Getter[T any] struct {
+	url string
+}
+
+func (r Getter[T]) URL() string {
+	return r.url
+}
+
+func (r Getter[T]) Get(c Caller) (value T, err error) {
+	err = c.Get(r.url, &value)
+	return value, err
+}
+
+func (r Getter[T]) GetContext(ctx context.Context, c ContextCaller) (value T, err error) {
+	err = c.GetContext(ctx, r.url, &value)
+	return value, err
+}
+
+// Resource is a resource answering GET and POST with T
+type Resource[T any] struct {
+	Getter[T]
+}
+
+// Set posts v and returns the resource updated by the agent
+func (r Resource[T]) Set(c Caller, v T) (value T, err error) {
+	err = c.Post(r.url, &v, &value)
+	return value, err
+}
+
+func (r Resource[T]) SetContext(ctx context.Context, c ContextCaller, v T) (value T, err error) {
+	err = c.PostContext(ctx, r.url, &v, &value)
+	return value, err
+}
+
+// Op is an operation posted with a T body
+type Op[T any] struct {
+	url string
+}
+
+func (r Op[T]) URL() string {
+	return r.url
+}
+
+func (r Op[T]) Post(c Caller, v T) error {
+	return c.Post(r.url, v, nil)
+}
+
+func (r Op[T]) PostContext(ctx context.Context, c ContextCaller, v T) error {
+	return c.PostContext(ctx, r.url, v, nil)
+}
+
+//
+// Agent: GET /
+//
+
+type AgentPath struct {
+	Getter[Agent]
+}
+
+// At returns the agent root, eg "cv40", "cv40:/" or "tcp://10.0.0.2:8080"
+func At(agent string) AgentPath {
+	root := agent
+	if u, err := url.Parse(agent); err == nil && u.Scheme != "" {
+		root = u.Scheme + ":"
+		if u.Host != "" {
+			root += "//" + u.Host
+		}
+	} else {
+		root = strings.TrimSuffix(agent, ":") + ":"
+	}
+	return AgentPath{Getter[Agent]{root + "/"}}
+}
+
+func (p AgentPath) Board(id int) BoardPath {
+	return BoardPath{Getter[Board]{p.url + strconv.Itoa(id)}}
+}
+
+func (p AgentPath) Canvas(id int) CanvasPath {
+	return CanvasPath{Getter[Input]{p.url + "canvas/" + strconv.Itoa(id)}}
+}
+
+//
+// Board: GET /:board
+//
+
+type BoardPath struct {
+	Getter[Board]
+}
+
+func (p BoardPath) Buttons() Getter[Buttons] {
+	return Getter[Buttons]{p.url + "/buttons"}
+}
+
+func (p BoardPath) Button(pin int) Getter[Button] {
+	return Getter[Button]{p.url + "/buttons/" + strconv.Itoa(pin)}
+}
+
+func (p BoardPath) Camera(id int) CameraPath {
+	return CameraPath{Getter[Camera]{p.url + "/camera/" + strconv.Itoa(id)}}
+}
+
+func (p BoardPath) HDMIOut(id int) Resource[Output] {
+	return p.Output("hdmi-out/" + strconv.Itoa(id))
+}
+
+func (p BoardPath) SDIOut(id int) Resource[Output] {
+	return p.Output("sdi-out/" + strconv.Itoa(id))
+}
+
+// Output by its board relative path, eg "hdmi-out/0"
+func (p BoardPath) Output(output string) Resource[Output] {
+	return Resource[Output]{Getter[Output]{p.url + "/" + strings.Trim(output, "/")}}
+}
+
+//
+// Camera: GET /:board/camera/:id
+//
+
+type CameraPath struct {
+	Getter[Camera]
+}
+
+func (p CameraPath) Exposure() Resource[CameraExposure] {
+	return Resource[CameraExposure]{Getter[CameraExposure]{p.url + "/exposure"}}
+}
+
+func (p CameraPath) White() Resource[CameraWhite] {
+	return Resource[CameraWhite]{Getter[CameraWhite]{p.url + "/white"}}
+}
+
+func (p CameraPath) Colors() Resource[CameraColors] {
+	return Resource[CameraColors]{Getter[CameraColors]{p.url + "/colors"}}
+}
+
+func (p CameraPath) Visuals() Resource[CameraVisuals] {
+	return Resource[CameraVisuals]{Getter[CameraVisuals]{p.url + "/visuals"}}
+}
+
+func (p CameraPath) Buttons() Getter[Buttons] {
+	return Getter[Buttons]{p.url + "/buttons"}
+}
+
+func (p CameraPath) Button(pin int) Getter[Button] {
+	return Getter[Button]{p.url + "/buttons/" + strconv.Itoa(pin)}
+}
+
+// DataURL creates data workers
+func (p CameraPath) DataURL() string {
+	return p.url + "/data"
+}
+
+// FileURL creates file workers
+func (p CameraPath) FileURL() string {
+	return p.url + "/file"
+}
+
+// Source as referenced by outputs and canvases, eg "0/camera/0"
+func (p CameraPath) Source() string {
+	return source(p.url)
+}
+
+//
+// Canvas: GET /canvas/:id
+//
+
+type CanvasPath struct {
+	Getter[Input]
+}
+
+// Delete resets the canvas to its "NO SIGNAL" state
+func (p CanvasPath) Delete(c Caller) error {
+	return c.Delete(p.url)
+}
+
+func (p CanvasPath) DeleteContext(ctx context.Context, c ContextCaller) error {
+	return c.DeleteContext(ctx, p.url)
+}
+
+func (p CanvasPath) Init() Op[CanvasInit] {
+	return Op[CanvasInit]{p.url + "/init"}
+}
+
+func (p CanvasPath) Clear() Op[CanvasClear] {
+	return Op[CanvasClear]{p.url + "/clear"}
+}
+
+func (p CanvasPath) Text() Op[CanvasText] {
+	return Op[CanvasText]{p.url + "/text"}
+}
+
+func (p CanvasPath) Line() Op[CanvasLine] {
+	return Op[CanvasLine]{p.url + "/line"}
+}
+
+func (p CanvasPath) Ellipse() Op[CanvasEllipse] {
+	return Op[CanvasEllipse]{p.url + "/ellipse"}
+}
+
+func (p CanvasPath) Rectangle() Op[CanvasRectangle] {
+	return Op[CanvasRectangle]{p.url + "/rectangle"}
+}
+
+func (p CanvasPath) Image() Op[CanvasImage] {
+	return Op[CanvasImage]{p.url + "/image"}
+}
+
+func (p CanvasPath) Video() Op[CanvasVideo] {
+	return Op[CanvasVideo]{p.url + "/video"}
+}
+
+func (p CanvasPath) Ops() Op[CanvasOps] {
+	return Op[CanvasOps]{p.url + "/ops"}
+}
+
+// DataURL creates data workers of the given format, eg "yuyv"
+func (p CanvasPath) DataURL(format string) string {
+	return p.url + "/" + format + "/data"
+}
+
+// FileURL creates file workers of the given format, eg "png"
+func (p CanvasPath) FileURL(format string) string {
+	return p.url + "/" + format + "/file"
+}
+
+// Source as referenced by outputs and canvases, eg "canvas/0"
+func (p CanvasPath) Source() string {
+	return source(p.url)
+}
+
+// Agent relative path of a resource url
+func source(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Path, "/")
+}
@@ -0,0 +1,105 @@
+package lt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+//
+// Partial updates
+//
+
+// Change of a resource field by a patch
+type Change struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// PatchOf returns the named json fields of v as a patch, eg
+// PatchOf(CameraVisuals{Zoom: 1.1}, "zoom")
+func PatchOf[T any](v T, fields ...string) (JSON, error) {
+	var all JSON
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+	patch := JSON{}
+	for _, f := range fields {
+		d, ok := all[f]
+		if !ok {
+			return nil, errors.New("unknown field: " + f)
+		}
+		patch[f] = d
+	}
+	return patch, nil
+}
+
+// Patch updates the fields of patch only: the agent merges a partial body, so
+// the fields missing from patch keep their current value, even when changed
+// concurrently. The resource is read first to return the changed fields
+// along with the resource updated by the agent.
+func (r Resource[T]) Patch(c Caller, patch JSON) (T, []Change, error) {
+	return r.patch(patch,
+		func(before *JSON) error { return c.Get(r.url, before) },
+		func(patch JSON, after *JSON) error { return c.Post(r.url, patch, after) })
+}
+
+func (r Resource[T]) PatchContext(ctx context.Context, c ContextCaller, patch JSON) (T, []Change, error) {
+	return r.patch(patch,
+		func(before *JSON) error { return c.GetContext(ctx, r.url, before) },
+		func(patch JSON, after *JSON) error { return c.PostContext(ctx, r.url, patch, after) })
+}
+
+func (r Resource[T]) patch(patch JSON, get func(*JSON) error, post func(JSON, *JSON) error) (value T, changes []Change, err error) {
+	// Unknown fields are rejected before calling the agent
+	fields := jsonFields(reflect.TypeOf(value))
+	for k := range patch {
+		if !slices.Contains(fields, k) {
+			return value, nil, &Error{Method: "POST", URL: r.url, Message: "unknown field: " + k, Kind: KindInvalidArgument}
+		}
+	}
+
+	var before, after JSON
+	if err := get(&before); err != nil {
+		return value, nil, err
+	}
+	if err := post(patch, &after); err != nil {
+		return value, nil, err
+	}
+
+	// Changed fields
+	for _, k := range fields {
+		if !reflect.DeepEqual(before[k], after[k]) {
+			changes = append(changes, Change{Field: k, Before: before[k], After: after[k]})
+		}
+	}
+
+	b, err := json.Marshal(after)
+	if err != nil {
+		return value, changes, err
+	}
+	err = json.Unmarshal(b, &value)
+	return value, changes, err
+}
+
+// Json field names of a struct type, in declaration order
+func jsonFields(t reflect.Type) (fields []string) {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,52 @@
+package lt_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// Only the patch is posted: a field changed meanwhile is kept
+func TestPatch(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	srv.Set("/0/camera/0/colors", lt.CameraColors{Brightness: 1, Contrast: 1})
+	var client lt.Client
+	defer client.Close()
+	colors := lt.At(srv.Agent()).Board(0).Camera(0).Colors()
+
+	// Another client sets the contrast between the read and the post
+	srv.Handle("GET", "/0/camera/0/colors", func(*lttest.Request) (any, error) {
+		var c lt.CameraColors
+		err := srv.Resource("/0/camera/0/colors", &c)
+		srv.Set("/0/camera/0/colors", lt.CameraColors{Brightness: c.Brightness, Contrast: 2})
+		return c, err
+	})
+	after, changes, err := colors.Patch(&client, lt.JSON{"brightness": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Brightness != 10 || after.Contrast != 2 {
+		t.Errorf("colors %+v, want brightness 10 and the concurrent contrast 2", after)
+	}
+	if len(changes) != 2 || changes[0].Field != "brightness" || changes[1].Field != "contrast" {
+		t.Errorf("changes %+v, want brightness and contrast", changes)
+	}
+
+	var body map[string]any
+	reqs := srv.Requests()
+	if err := json.Unmarshal(reqs[len(reqs)-1].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 1 || body["brightness"] != 10.0 {
+		t.Errorf("posted %v, want the brightness only", body)
+	}
+
+	// Unknown fields are not sent
+	n := len(srv.Requests())
+	if _, _, err := colors.Patch(&client, lt.JSON{"bright": 1}); err == nil || len(srv.Requests()) != n {
+		t.Errorf("unknown field: %v after %d requests", err, len(srv.Requests())-n)
+	}
+}
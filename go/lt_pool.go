@@ -0,0 +1,325 @@
+package lt
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Pooled client
+//
+
+// Pool limits, zero values select the defaults
+type PoolConfig struct {
+	MaxConns    int           // Connections per agent, besides those owning workers (default 4)
+	MaxIdle     int           // Idle connections kept per agent (default 2)
+	IdleTimeout time.Duration // Idle connections are checked before reuse (default 30s)
+}
+
+// NewPooledClient returns a client which spreads concurrent calls over several
+// connections per agent. Workers and shared packets stay bound to the
+// connection which created them, as the agent owns them per connection.
+func NewPooledClient(config PoolConfig) *Client {
+	if config.MaxConns <= 0 {
+		config.MaxConns = 4
+	}
+	if config.MaxIdle <= 0 {
+		config.MaxIdle = 2
+	}
+	if config.MaxIdle > config.MaxConns {
+		config.MaxIdle = config.MaxConns
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 30 * time.Second
+	}
+	c := &Client{
+		pool: &pool{
+			config: config,
+			conns:  map[string]*connPool{},
+			owners: map[string]*owner{},
+		},
+	}
+	c.pool.watcher = &c.watcher
+	return c
+}
+
+type pool struct {
+	config  PoolConfig
+	conns   map[string]*connPool // Agents (scheme + host)
+	owners  map[string]*owner    // Worker locations
+	watcher *watcher
+	mu      sync.Mutex
+}
+
+// Connection which created a worker, workers do not survive a reconnection
+type owner struct {
+	rt      *roundTripper
+	gen     int
+	cp      *connPool
+	stopped time.Time // Stop requested, the remaining packets may be left unread
+	used    time.Time
+}
+
+// Connections owning workers are kept out of the idle list and do not count
+// in the limit, so other calls never queue behind a worker long-poll
+type connPool struct {
+	key   string        // Agent, eg "cv40:"
+	ping  string        // Agent url used to check idle connections
+	sem   chan struct{} // Connections in use
+	idle  []idleConn
+	owned map[*roundTripper]bool
+}
+
+type idleConn struct {
+	rt    *roundTripper
+	since time.Time
+}
+
+func (p *pool) Call(ctx context.Context, method, location string, body, response any) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+
+	// Workers are served by the connection which created them
+	if o, ok := p.owner(location); ok {
+		err := o.rt.CallContext(ctx, method, location, body, response)
+		p.track(method, location, o.rt, o.cp, err)
+		return err
+	}
+
+	// Any pooled connection
+	cp := p.agent(u)
+	rt, err := p.acquire(ctx, cp)
+	if err != nil {
+		return transportError(method, location, err)
+	}
+	err = rt.CallContext(ctx, method, location, body, response)
+	p.track(method, location, rt, cp, err)
+	p.release(cp, rt)
+	return err
+}
+
+// Close all idle and worker connections, connections in use are closed once
+// released
+func (p *pool) Close() error {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = map[string]*connPool{}
+	p.owners = map[string]*owner{}
+	var rts []*roundTripper
+	for _, cp := range conns {
+		for _, ic := range cp.idle {
+			rts = append(rts, ic.rt)
+		}
+		cp.idle = nil
+		for rt := range cp.owned {
+			rts = append(rts, rt)
+		}
+		cp.owned = nil
+	}
+	p.mu.Unlock()
+
+	var err error
+	for _, rt := range rts {
+		if cerr := rt.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (p *pool) owner(location string) (owner, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if worker, ok := p.ownerKey(location); ok {
+		o := p.owners[worker]
+		o.used = time.Now()
+		return *o, true
+	}
+	return owner{}, false
+}
+
+// Worker location of a url, eg "cv40:/client/jobs/1" for its "/stop"
+func (p *pool) ownerKey(location string) (string, bool) {
+	for worker := range p.owners {
+		if location == worker || strings.HasPrefix(location, worker+"/") {
+			return worker, true
+		}
+	}
+	return "", false
+}
+
+// Track the workers created or ended by a call. Workers end on EOF, errors,
+// deletion, or once stopped and left unpolled for the idle timeout.
+func (p *pool) track(method, location string, rt *roundTripper, cp *connPool, err error) {
+	alive, gen := rt.state()
+
+	p.mu.Lock()
+	worker, owned := p.ownerKey(location)
+	switch {
+	case errors.Is(err, ErrRedirect):
+		// Worker created, or its next file on a split
+		if owned {
+			delete(p.owners, worker)
+		}
+		p.owners[RedirectLocation(err)] = &owner{rt: rt, gen: gen, cp: cp, used: time.Now()}
+	case !owned:
+	case err != nil:
+		switch ErrorKindOf(err) {
+		case KindBusy, KindUpdating:
+		default:
+			if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+				delete(p.owners, worker)
+			}
+		}
+	case method == "DELETE" && location == worker:
+		delete(p.owners, worker)
+	case method == "POST" && location == worker+"/stop":
+		p.owners[worker].stopped = time.Now()
+	}
+	for worker, o := range p.owners {
+		if o.rt == rt && (!alive || o.gen != gen) {
+			delete(p.owners, worker)
+		}
+	}
+	returned := p.unpin()
+	p.mu.Unlock()
+
+	for _, r := range returned {
+		p.keep(r.cp, r.rt)
+	}
+}
+
+type pinnedConn struct {
+	rt *roundTripper
+	cp *connPool
+}
+
+// Drop the stale stopped workers and collect the connections left without
+// workers, p.mu held
+func (p *pool) unpin() []pinnedConn {
+	for worker, o := range p.owners {
+		if !o.stopped.IsZero() && time.Since(o.used) > p.config.IdleTimeout {
+			delete(p.owners, worker)
+		}
+	}
+	var returned []pinnedConn
+	for _, cp := range p.conns {
+		for rt := range cp.owned {
+			if !p.pinned(rt) {
+				delete(cp.owned, rt)
+				returned = append(returned, pinnedConn{rt: rt, cp: cp})
+			}
+		}
+	}
+	return returned
+}
+
+// Connections owning workers are kept open whatever the idle limit
+func (p *pool) pinned(rt *roundTripper) bool {
+	for _, o := range p.owners {
+		if o.rt == rt {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pool) agent(u *url.URL) *connPool {
+	key := u.Scheme + ":" + u.Host
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cp, ok := p.conns[key]
+	if !ok {
+		cp = &connPool{
+			key:   key,
+			ping:  u.Scheme + ":/",
+			sem:   make(chan struct{}, p.config.MaxConns),
+			owned: map[*roundTripper]bool{},
+		}
+		if u.Host != "" {
+			cp.ping = u.Scheme + "://" + u.Host + "/"
+		}
+		p.conns[key] = cp
+	}
+	return cp
+}
+
+func (p *pool) acquire(ctx context.Context, cp *connPool) (*roundTripper, error) {
+	// Connections of stale workers are idle again
+	p.mu.Lock()
+	returned := p.unpin()
+	p.mu.Unlock()
+	for _, r := range returned {
+		p.keep(r.cp, r.rt)
+	}
+
+	// Wait for a free slot
+	select {
+	case cp.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		// Most recently used idle connection
+		p.mu.Lock()
+		n := len(cp.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			return &roundTripper{watcher: p.watcher}, nil
+		}
+		ic := cp.idle[n-1]
+		cp.idle = cp.idle[:n-1]
+		p.mu.Unlock()
+
+		// Health check
+		if time.Since(ic.since) < p.config.IdleTimeout || p.check(ctx, cp, ic.rt) {
+			return ic.rt, nil
+		}
+		ic.rt.Close()
+	}
+}
+
+func (p *pool) check(ctx context.Context, cp *connPool, rt *roundTripper) bool {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	rt.CallContext(ctx, "GET", cp.ping, nil, nil)
+	return rt.alive()
+}
+
+// Release a connection after a call, connections owning workers are set
+// aside until the workers end
+func (p *pool) release(cp *connPool, rt *roundTripper) {
+	defer func() { <-cp.sem }()
+
+	alive := rt.alive()
+	p.mu.Lock()
+	if alive && p.conns[cp.key] == cp && p.pinned(rt) {
+		cp.owned[rt] = true
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	p.keep(cp, rt)
+}
+
+// Keep a connection idle up to the idle limit, close it otherwise
+func (p *pool) keep(cp *connPool, rt *roundTripper) {
+	alive := rt.alive()
+	p.mu.Lock()
+	keep := alive && p.conns[cp.key] == cp && len(cp.idle) < p.config.MaxIdle
+	if keep {
+		cp.idle = append(cp.idle, idleConn{rt: rt, since: time.Now()})
+	}
+	p.mu.Unlock()
+
+	if !keep {
+		rt.Close()
+	}
+}
@@ -0,0 +1,163 @@
+package lt_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// Calls are not served by a connection busy with a worker long-poll
+func TestPoolWorkerLongPoll(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	srv.Poll = 3 * time.Second
+	client := lt.NewPooledClient(lt.PoolConfig{MaxConns: 2})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := lt.CreateDataWorker(ctx, client, srv.URL("/0/camera/0"), lt.ImageDataWorker{Media: "image/yuv422"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	polling := make(chan struct{})
+	go func() {
+		defer close(polling)
+		for range h.Packets(ctx) {
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		callCtx, callCancel := context.WithTimeout(ctx, time.Second)
+		start := time.Now()
+		err := client.GetContext(callCtx, srv.URL("/0/camera/0"), nil)
+		callCancel()
+		if err != nil {
+			t.Fatalf("call %d during the long-poll: %v after %v", i, err, time.Since(start))
+		}
+	}
+	cancel()
+	<-polling
+}
+
+// Connections of ended workers serve calls again
+func TestPoolWorkerEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(ctx context.Context, c *lt.Client, h *lt.WorkerHandle) error
+	}{
+		{"delete", func(ctx context.Context, c *lt.Client, h *lt.WorkerHandle) error {
+			return c.DeleteContext(ctx, h.URL)
+		}},
+		{"stop and drain", func(ctx context.Context, c *lt.Client, h *lt.WorkerHandle) error {
+			if err := h.Stop(ctx); err != nil {
+				return err
+			}
+			_, err := h.Wait(ctx)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := lttest.NewServer()
+			defer srv.Close()
+			client := lt.NewPooledClient(lt.PoolConfig{MaxConns: 2})
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for i := 0; i < 5; i++ {
+				h, err := lt.CreateDataWorker(ctx, client, srv.URL("/0/camera/0"), lt.ImageDataWorker{Media: "image/yuv422"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := tt.end(ctx, client, h); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			conns := map[int]bool{}
+			for _, req := range srv.Requests() {
+				conns[req.Client] = true
+			}
+			if len(conns) != 1 {
+				t.Errorf("workers used %d connections, want 1", len(conns))
+			}
+		})
+	}
+}
+
+// Still captures waited to their end leave no connection owned
+func TestPoolFileWorkerCaptures(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	srv.OnWorker(func(w *lttest.Worker) {
+		w.SetName("still.jpg")
+		w.Push(lttest.Packet{Data: make([]byte, 10)})
+		w.End()
+	})
+	client := lt.NewPooledClient(lt.PoolConfig{MaxConns: 2})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 20; i++ {
+		h, err := lt.CreateFileWorker(ctx, client, srv.URL("/0/camera/0"), lt.ImageFileWorker{Media: "image/jpeg", Location: "/data"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.GetContext(ctx, srv.URL("/0/camera/0"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conns := map[int]bool{}
+	for _, req := range srv.Requests() {
+		conns[req.Client] = true
+	}
+	if len(conns) > 2 {
+		t.Errorf("captures used %d connections, want at most 2", len(conns))
+	}
+}
+
+// Concurrent calls spread over up to MaxConns connections
+func TestPoolConcurrentCalls(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	var inFlight, most atomic.Int32
+	srv.Handle("GET", "/slow", func(*lttest.Request) (any, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		time.Sleep(200 * time.Millisecond)
+		return nil, nil
+	})
+	client := lt.NewPooledClient(lt.PoolConfig{MaxConns: 4})
+	defer client.Close()
+
+	start := time.Now()
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		go func() { errs <- client.Get(srv.URL("/slow"), nil) }()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 700*time.Millisecond {
+		t.Errorf("8 calls of 200ms took %v over 4 connections", elapsed)
+	}
+	if n := most.Load(); n > 4 {
+		t.Errorf("%d concurrent calls, limit 4", n)
+	}
+}
@@ -0,0 +1,226 @@
+package lt
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/url"
+	"sync"
+	"time"
+)
+
+//
+// Reconnection
+//
+
+// Reconnection policy, zero values select the defaults
+type Backoff struct {
+	Min      time.Duration // First retry delay (default 100ms)
+	Max      time.Duration // Maximum retry delay (default 5s)
+	Attempts int           // Dial attempts per call (default 5)
+	Retries  int           // Replays of a GET after a connection loss, negative disables (default 2)
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Min <= 0 {
+		b.Min = 100 * time.Millisecond
+	}
+	if b.Max < b.Min {
+		b.Max = max(5*time.Second, b.Min)
+	}
+	if b.Attempts <= 0 {
+		b.Attempts = 5
+	}
+	if b.Retries < 0 {
+		b.Retries = 0
+	} else if b.Retries == 0 {
+		b.Retries = 2
+	}
+	return b
+}
+
+// Jittered delay before the next attempt, in [d/2, d)
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Min << min(attempt, 30)
+	if d <= 0 || d > b.Max {
+		d = b.Max
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+type ConnState int
+
+const (
+	Connected    ConnState = iota // First connection to the agent
+	Disconnected                  // Connection lost
+	Reconnected                   // Connection back after a loss
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case Connected:
+		return "connected"
+	case Disconnected:
+		return "disconnected"
+	case Reconnected:
+		return "reconnected"
+	default:
+		return "unknown"
+	}
+}
+
+// Agent connection event
+type ConnEvent struct {
+	State ConnState
+	Agent string // Scheme and host, eg "cv40:" or "tcp:192.168.1.10:8080"
+	Err   error  // Disconnection cause
+	Time  time.Time
+}
+
+// Policy, events, capture and interceptors shared by the client connections
+type watcher struct {
+	backoff      Backoff
+	handlers     []func(ConnEvent)
+	capture      *capture
+	interceptors []Interceptor
+	chain        CallFunc
+	agents       map[string]ConnState
+	capabilities map[string]Capabilities // Per connection, see Client.Capabilities
+	queue        []ConnEvent
+	running      bool
+	mu           sync.Mutex
+}
+
+func (w *watcher) policy() Backoff {
+	if w == nil {
+		return Backoff{}.withDefaults()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.backoff.withDefaults()
+}
+
+func (w *watcher) connected(agent string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.agents == nil {
+		w.agents = map[string]ConnState{}
+	}
+	state, seen := w.agents[agent]
+	w.agents[agent] = Connected
+	if !seen || state == Disconnected {
+		delete(w.capabilities, agent)
+	}
+	switch {
+	case !seen:
+		w.emit(ConnEvent{State: Connected, Agent: agent})
+	case state == Disconnected:
+		w.agents[agent] = Reconnected
+		w.emit(ConnEvent{State: Reconnected, Agent: agent})
+	}
+}
+
+func (w *watcher) disconnected(agent string, err error) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if state, seen := w.agents[agent]; seen && state != Disconnected {
+		w.agents[agent] = Disconnected
+		w.emit(ConnEvent{State: Disconnected, Agent: agent, Err: err})
+	}
+}
+
+// Handlers run in order on a separate goroutine, so they may call the client
+func (w *watcher) emit(e ConnEvent) {
+	if len(w.handlers) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	w.queue = append(w.queue, e)
+	if w.running {
+		return
+	}
+	w.running = true
+	go func() {
+		for {
+			w.mu.Lock()
+			if len(w.queue) == 0 {
+				w.running = false
+				w.mu.Unlock()
+				return
+			}
+			e := w.queue[0]
+			w.queue = w.queue[1:]
+			handlers := w.handlers
+			w.mu.Unlock()
+			for _, fn := range handlers {
+				fn(e)
+			}
+		}
+	}()
+}
+
+// Dial the agent, retrying with a jittered exponential backoff
+func (rt *roundTripper) connect(ctx context.Context, location string, u *url.URL) error {
+	b := rt.watcher.policy()
+	for attempt := 0; ; attempt++ {
+		err := rt.open(ctx, location)
+		if err == nil {
+			rt.scheme = u.Scheme
+			rt.agent = u.Scheme + ":" + u.Host
+			rt.gen++
+			rt.live.Store(int64(rt.gen))
+			rt.watcher.connected(rt.agent)
+			return nil
+		}
+		if attempt+1 >= b.Attempts || ctx.Err() != nil {
+			return err
+		}
+		timer := time.NewTimer(b.delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Connection lost, the next call dials again
+func (rt *roundTripper) lost(err error) {
+	rt.drop()
+	rt.watcher.disconnected(rt.agent, err)
+}
+
+// SetBackoff sets the reconnection policy
+func (c *Client) SetBackoff(b Backoff) {
+	c.watcher.mu.Lock()
+	c.watcher.backoff = b
+	c.watcher.mu.Unlock()
+	c.bind()
+}
+
+// OnConnEvent registers a handler for the agent connection events
+func (c *Client) OnConnEvent(fn func(ConnEvent)) {
+	c.watcher.mu.Lock()
+	c.watcher.handlers = append(c.watcher.handlers, fn)
+	c.watcher.mu.Unlock()
+	c.bind()
+}
+
+func (c *Client) bind() {
+	if c.pool != nil {
+		return
+	}
+	rt := &c.roundTripper
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.watcher = &c.watcher
+	if rt.conn != nil {
+		rt.watcher.connected(rt.agent)
+	}
+}
@@ -0,0 +1,125 @@
+package lt_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// Events of a client, in order
+type connEvents struct {
+	events []lt.ConnEvent
+	mu     sync.Mutex
+}
+
+func (e *connEvents) add(ev lt.ConnEvent) {
+	e.mu.Lock()
+	e.events = append(e.events, ev)
+	e.mu.Unlock()
+}
+
+// Wait for n events, handlers run on their own goroutine
+func (e *connEvents) wait(t *testing.T, n int) []lt.ConnState {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		e.mu.Lock()
+		states := make([]lt.ConnState, len(e.events))
+		for i, ev := range e.events {
+			states[i] = ev.State
+		}
+		e.mu.Unlock()
+		if len(states) >= n || time.Now().After(deadline) {
+			return states
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// A GET lost with the connection is replayed on a new one
+func TestReconnectReplaysGet(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	var client lt.Client
+	defer client.Close()
+	client.SetBackoff(lt.Backoff{Min: time.Millisecond})
+	var events connEvents
+	client.OnConnEvent(events.add)
+
+	var camera lt.Camera
+	if err := client.Get(srv.URL("/0/camera/0"), &camera); err != nil {
+		t.Fatal(err)
+	}
+	srv.Disconnect()
+	camera = lt.Camera{}
+	if err := client.Get(srv.URL("/0/camera/0"), &camera); err != nil {
+		t.Fatalf("get after disconnection: %v", err)
+	}
+	if camera.Model != "CV40" {
+		t.Errorf("camera model %q, want CV40", camera.Model)
+	}
+
+	want := []lt.ConnState{lt.Connected, lt.Disconnected, lt.Reconnected}
+	states := events.wait(t, len(want))
+	if len(states) != len(want) {
+		t.Fatalf("events %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("events %v, want %v", states, want)
+		}
+	}
+}
+
+// A POST lost with the connection may have been processed, it is not replayed
+func TestReconnectDoesNotReplayPost(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	var client lt.Client
+	defer client.Close()
+	client.SetBackoff(lt.Backoff{Min: time.Millisecond})
+
+	if err := client.Get(srv.URL("/0/camera/0"), nil); err != nil {
+		t.Fatal(err)
+	}
+	srv.Disconnect()
+	err := client.Post(srv.URL("/0/camera/0/colors"), lt.JSON{"brightness": 10}, nil)
+	if err == nil {
+		t.Fatal("post on a lost connection succeeded")
+	}
+	if lt.ErrorKindOf(err) != lt.KindTransport {
+		t.Errorf("post error kind %v, want transport: %v", lt.ErrorKindOf(err), err)
+	}
+
+	// The next call dials again
+	if err := client.Post(srv.URL("/0/camera/0/colors"), lt.JSON{"brightness": 10}, nil); err != nil {
+		t.Fatalf("post after reconnection: %v", err)
+	}
+	var colors lt.CameraColors
+	if err := srv.Resource("/0/camera/0/colors", &colors); err != nil {
+		t.Fatal(err)
+	}
+	if colors.Brightness != 10 {
+		t.Errorf("brightness %v, want 10", colors.Brightness)
+	}
+}
+
+// Calls fail with a transport error once the dial attempts are exhausted
+func TestReconnectAgentGone(t *testing.T) {
+	srv := lttest.NewServer()
+	var client lt.Client
+	defer client.Close()
+	client.SetBackoff(lt.Backoff{Min: time.Millisecond, Max: 5 * time.Millisecond, Attempts: 3})
+
+	if err := client.Get(srv.URL("/0/camera/0"), nil); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	err := client.Get(srv.URL("/0/camera/0"), nil)
+	if lt.ErrorKindOf(err) != lt.KindTransport {
+		t.Fatalf("get on a gone agent: %v, want a transport error", err)
+	}
+}
@@ -0,0 +1,50 @@
+package lt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// A call queued behind a slow one on the same connection gives up with its
+// context
+func TestCallQueuedBehindSlowCall(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	srv.Handle("GET", "/slow", func(*lttest.Request) (any, error) {
+		time.Sleep(2 * time.Second)
+		return nil, nil
+	})
+
+	var client lt.Client
+	defer client.Close()
+	if err := client.Get(srv.URL("/0/camera/0"), nil); err != nil {
+		t.Fatal(err)
+	}
+	slow := make(chan error, 1)
+	go func() { slow <- client.Get(srv.URL("/slow"), nil) }()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := client.GetContext(ctx, srv.URL("/0/camera/0"), nil)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("queued call returned after %v, budget 200ms", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("queued call: got %v, want DeadlineExceeded", err)
+	}
+	if lt.ErrorKindOf(err) != lt.KindTransport {
+		t.Errorf("queued call: got kind %v, want transport", lt.ErrorKindOf(err))
+	}
+
+	// The slow call is unaffected
+	if err := <-slow; err != nil {
+		t.Errorf("slow call: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package lt
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//
+// Agent versions and features
+//
+
+// APIVersion is the agent API version the schema structs target
+const APIVersion = "1.3.0"
+
+// SupportedVersions is the range of agent versions the client works with
+var SupportedVersions = VersionRange{Min: Version{1, 0, 0}, Max: Version{2, 0, 0}}
+
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// ParseVersion parses "1.3.0", "v1.3" or "1.3.0-rc1", pre-release and build
+// suffixes are ignored
+func ParseVersion(s string) (Version, error) {
+	core, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(s), "v"), "-")
+	core, _, _ = strings.Cut(core, "+")
+	parts := strings.Split(core, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("lt: invalid version %q", s)
+	}
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return Version{}, fmt.Errorf("lt: invalid version %q", s)
+		}
+		n[i] = v
+	}
+	return Version{n[0], n[1], n[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 as v is older, equal or newer than o
+func (v Version) Compare(o Version) int {
+	for _, d := range [3]int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return max(-1, min(1, d))
+		}
+	}
+	return 0
+}
+
+// VersionRange holds the versions from Min included to Max excluded
+type VersionRange struct {
+	Min, Max Version
+}
+
+func (r VersionRange) Contains(v Version) bool {
+	return v.Compare(r.Min) >= 0 && v.Compare(r.Max) < 0
+}
+
+func (r VersionRange) String() string {
+	return "[" + r.Min.String() + ", " + r.Max.String() + ")"
+}
+
+// Feature of the agent API, available from a version on
+type Feature string
+
+const (
+	FeatureSharedMemory Feature = "shared-memory" // Packets data in shared memory blocks
+	FeatureSDIOut       Feature = "sdi-out"       // /:board/sdi-out/:id outputs
+	FeatureOSD          Feature = "osd"           // Output on screen display
+	FeatureLowLight     Feature = "low-light"     // Low light boost and shadow lighting
+	FeatureCanvasOps    Feature = "canvas-ops"    // Batched /canvas/:id/ops drawing
+	FeatureNV12         Feature = "nv12"          // Native NV12 media
+)
+
+// Version adding each feature, from the API changelog, 1.0.0 for those of
+// the first release
+var featureVersions = map[Feature]Version{
+	FeatureSharedMemory: {1, 0, 0},
+	FeatureSDIOut:       {1, 0, 0},
+	FeatureOSD:          {1, 1, 0},
+	FeatureLowLight:     {1, 2, 0},
+	FeatureCanvasOps:    {1, 0, 0},
+	FeatureNV12:         {1, 3, 0},
+}
+
+// Capabilities of an agent, from its version. Versions which do not parse,
+// eg development builds, are assumed to support every feature.
+type Capabilities struct {
+	Agent    string // Scheme and host, eg "cv40:"
+	Version  string
+	Revision string
+
+	SupportsSharedMemory bool
+	SupportsSDIOut       bool
+	SupportsOSD          bool
+	SupportsLowLight     bool
+	SupportsCanvasOps    bool
+	SupportsNV12         bool
+
+	version Version
+	known   bool
+}
+
+func newCapabilities(agent string, a Agent) Capabilities {
+	c := Capabilities{Agent: agent, Version: a.Version, Revision: a.Revision}
+	if v, err := ParseVersion(a.Version); err == nil {
+		c.version, c.known = v, true
+	}
+	c.SupportsSharedMemory = c.Supports(FeatureSharedMemory)
+	c.SupportsSDIOut = c.Supports(FeatureSDIOut)
+	c.SupportsOSD = c.Supports(FeatureOSD)
+	c.SupportsLowLight = c.Supports(FeatureLowLight)
+	c.SupportsCanvasOps = c.Supports(FeatureCanvasOps)
+	c.SupportsNV12 = c.Supports(FeatureNV12)
+	return c
+}
+
+func (c Capabilities) Supports(f Feature) bool {
+	since, ok := featureVersions[f]
+	return !c.known || !ok || c.version.Compare(since) >= 0
+}
+
+// Check returns a *VersionError when the agent version is outside
+// SupportedVersions
+func (c Capabilities) Check() error {
+	if c.known && !SupportedVersions.Contains(c.version) {
+		return &VersionError{Agent: c.Agent, Version: c.Version, Supported: SupportedVersions}
+	}
+	return nil
+}
+
+// Missing returns the features of fs the agent lacks
+func (c Capabilities) Missing(fs ...Feature) []Feature {
+	var missing []Feature
+	for _, f := range fs {
+		if !c.Supports(f) {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// VersionError is an agent version outside the supported range
+type VersionError struct {
+	Agent     string
+	Version   string
+	Supported VersionRange
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("lt: %s agent version %s outside the supported range %s", e.Agent, e.Version, e.Supported)
+}
+
+// UnsupportedError is the cause of a KindUnsupported call error: a feature
+// called on an agent older than the version adding it
+type UnsupportedError struct {
+	Feature Feature
+	Agent   string
+	Version string  // Agent version
+	Since   Version // Version adding the feature
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s agent version %s lacks %s, added in %s", e.Agent, e.Version, e.Feature, e.Since)
+}
+
+// Capabilities returns the capabilities of the agent of a url, eg "cv40" or
+// "cv40:/0/camera/0". The agent version is fetched once per connection.
+func (c *Client) Capabilities(ctx context.Context, agent string) (Capabilities, error) {
+	c.bind() // Reconnections invalidate the cache
+	key := agentKey(agent)
+	c.watcher.mu.Lock()
+	caps, ok := c.watcher.capabilities[key]
+	c.watcher.mu.Unlock()
+	if ok {
+		return caps, nil
+	}
+	a, err := At(agent).GetContext(ctx, c)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	caps = newCapabilities(key, a)
+	c.watcher.mu.Lock()
+	if c.watcher.capabilities == nil {
+		c.watcher.capabilities = map[string]Capabilities{}
+	}
+	c.watcher.capabilities[key] = caps
+	c.watcher.mu.Unlock()
+	return caps, nil
+}
+
+// Agent of a url as connections name it, eg "cv40:" or "tcp:10.0.0.2:8080"
+func agentKey(location string) string {
+	if u, err := url.Parse(location); err == nil && u.Scheme != "" {
+		return u.Scheme + ":" + u.Host
+	}
+	return strings.TrimSuffix(location, ":") + ":"
+}
+
+// Feature a call needs, if any
+func featureOf(method, location string, body any) (Feature, bool) {
+	p := location
+	if u, err := url.Parse(location); err == nil {
+		p = u.Path
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	switch {
+	case len(segments) == 3 && segments[0] == "canvas" && segments[2] == "ops":
+		return FeatureCanvasOps, true
+	case len(segments) >= 2 && segments[1] == "sdi-out":
+		return FeatureSDIOut, true
+	case method == "POST" && strings.HasSuffix(workerMedia(body), "/nv12"):
+		return FeatureNV12, true
+	}
+	return "", false
+}
+
+// Media of a worker creation body
+func workerMedia(body any) string {
+	switch b := body.(type) {
+	case ImageDataWorker:
+		return b.Media
+	case VideoDataWorker:
+		return b.Media
+	case ImageFileWorker:
+		return b.Media
+	case VideoFileWorker:
+		return b.Media
+	case JSON:
+		media, _ := b["media"].(string)
+		return media
+	}
+	return ""
+}
+
+// Calls needing a feature fail with a KindUnsupported error on older agents.
+// Agents which cannot tell their version are left to answer the call.
+func (c *Client) require(ctx context.Context, method, location string, body any) error {
+	f, ok := featureOf(method, location, body)
+	if !ok {
+		return nil
+	}
+	caps, err := c.Capabilities(ctx, location)
+	if err != nil || caps.Supports(f) {
+		return nil
+	}
+	cause := &UnsupportedError{Feature: f, Agent: caps.Agent, Version: caps.Version, Since: featureVersions[f]}
+	return &Error{Method: method, URL: location, Message: cause.Error(), Kind: KindUnsupported, Err: cause}
+}
@@ -0,0 +1,66 @@
+package lt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// Calls needing a feature are refused on agents older than its version
+func TestRequireFeature(t *testing.T) {
+	tests := []struct {
+		version     string
+		url         string
+		body        any
+		unsupported bool
+	}{
+		{"1.0.0", "/canvas/0/ops", lt.JSON{}, false},
+		{"1.2.0", "/0/camera/0/data", lt.ImageDataWorker{Media: "image/nv12"}, true},
+		{"1.3.0", "/0/camera/0/data", lt.ImageDataWorker{Media: "image/nv12"}, false},
+		{"dev", "/0/camera/0/data", lt.ImageDataWorker{Media: "image/nv12"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version+" "+tt.url, func(t *testing.T) {
+			srv := lttest.NewServer()
+			defer srv.Close()
+			srv.Set("/", lt.Agent{Version: tt.version})
+			var client lt.Client
+			defer client.Close()
+
+			err := client.PostContext(context.Background(), srv.URL(tt.url), tt.body, nil)
+			if unsupported := errors.Is(err, lt.ErrUnsupported); unsupported != tt.unsupported {
+				t.Errorf("unsupported %v, want %v: %v", unsupported, tt.unsupported, err)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		version                   string
+		canvasOps, lowLight, nv12 bool
+	}{
+		{"1.0.0", true, false, false},
+		{"1.2.0", true, true, false},
+		{"1.3.0", true, true, true},
+		{"dev", true, true, true},
+	}
+	for _, tt := range tests {
+		srv := lttest.NewServer()
+		srv.Set("/", lt.Agent{Version: tt.version})
+		var client lt.Client
+		caps, err := client.Capabilities(context.Background(), srv.Agent())
+		client.Close()
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if caps.SupportsCanvasOps != tt.canvasOps || caps.SupportsLowLight != tt.lowLight || caps.SupportsNV12 != tt.nv12 {
+			t.Errorf("%s: canvas ops %v, low light %v, nv12 %v, want %v, %v, %v", tt.version,
+				caps.SupportsCanvasOps, caps.SupportsLowLight, caps.SupportsNV12, tt.canvasOps, tt.lowLight, tt.nv12)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package lt
 
 import (
+	"container/list"
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"net/url"
 	"os"
-	"path"
 	"strconv"
 	"time"
 	"unsafe"
@@ -19,44 +20,34 @@ import (
 // Conn
 //
 
-func dial(addr string) (net.Conn, error) {
-	u, err := url.Parse(addr)
+// Baudrate as url port, eg "uart://3:115200" for COM3
+func dialUART(ctx context.Context, u *url.URL) (net.Conn, error) {
+	var err error
+	port := u.Hostname()
+	baurate := 115200
+	if u.Port() != "" {
+		if baurate, err = strconv.Atoi(u.Port()); err != nil {
+			return nil, fmt.Errorf("invalid baudrate: %s %w", u.Port(), err)
+		}
+	}
+	uart, err := serial.OpenPort(&serial.Config{Name: "COM" + port, Baud: baurate})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unknown uart port: %s %w", u.Scheme, err)
 	}
+	return &UARTConn{uart}, nil
+}
 
-	switch u.Scheme {
-	// UART
-	case "uart":
-		port := u.Hostname()
-		baurate := 115200
-		if u.Port() != "" {
-			if baurate, err = strconv.Atoi(u.Port()); err != nil {
-				return nil, fmt.Errorf("invalid baudrate: %s %w", u.Port(), err)
-			}
-		}
-		uart, err := serial.OpenPort(&serial.Config{Name: "COM" + port, Baud: baurate})
-		if err != nil {
-			return nil, fmt.Errorf("unknown uart port: %s %w", u.Scheme, err)
-		}
-		return &UARTConn{uart}, nil
-
-	// TCP
-	case "tcp":
-		return net.Dial("tcp", u.Host)
-
-	// Unix
+// Named pipe or unix socket named after the scheme
+func dialLocal(ctx context.Context, u *url.URL) (net.Conn, error) {
+	switch u.Host {
+	// Windows: Unix Domain Socket
+	case "unix":
+		return UnixDialer(os.TempDir())(ctx, u)
+	// Windows: Named Pipe (default)
+	case "pipe", "":
+		return pipeDial("\\\\.\\pipe\\" + u.Scheme)
 	default:
-		switch u.Host {
-		// Windows: Unix Domain Socket
-		case "unix":
-			return net.Dial("unix", path.Join(os.TempDir(), u.Scheme+".sock"))
-		// Windows: Named Pipe (default)
-		case "pipe", "":
-			return pipeDial("\\\\.\\pipe\\" + u.Scheme)
-		default:
-			return nil, fmt.Errorf("unknown port: %s", u.Port())
-		}
+		return nil, fmt.Errorf("unknown port: %s", u.Port())
 	}
 }
 
@@ -76,17 +67,17 @@ func (uart *UARTConn) RemoteAddr() net.Addr {
 	return nil
 }
 
+// Deadlines are not supported, the round tripper closes the port instead
 func (uart *UARTConn) SetDeadline(t time.Time) error {
-	return nil
+	return os.ErrNoDeadline
 }
 
 func (uart *UARTConn) SetReadDeadline(t time.Time) error {
-	return nil
-
+	return os.ErrNoDeadline
 }
 
 func (uart *UARTConn) SetWriteDeadline(t time.Time) error {
-	return nil
+	return os.ErrNoDeadline
 }
 
 //
@@ -98,6 +89,10 @@ type buffer struct {
 	ref    int
 	handle windows.Handle
 	ptr    uintptr
+
+	// Shared buffers cache
+	key  string
+	elem *list.Element
 }
 
 func mapBuffer(handle string, size int) (*buffer, error) {
@@ -137,6 +132,7 @@ func (b *buffer) Close() error {
 	if b.ptr != uintptr(0) {
 		windows.UnmapViewOfFile(b.ptr)
 		b.ptr = uintptr(0)
+		b.Data = nil
 	}
 	if b.handle != windows.InvalidHandle {
 		windows.CloseHandle(b.handle)
@@ -193,3 +189,16 @@ func (c *pipeConn) Write(p []byte) (int, error) {
 func (c *pipeConn) Close() error {
 	return windows.CloseHandle(c.handle)
 }
+
+// Deadlines are not supported, the round tripper closes the pipe instead
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	return os.ErrNoDeadline
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	return os.ErrNoDeadline
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	return os.ErrNoDeadline
+}
@@ -0,0 +1,159 @@
+package lt
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+	"sync"
+)
+
+//
+// Worker handles
+//
+
+// WorkerHandle drives a worker created on the agent. The agent owns workers
+// per connection, so the handle keeps calling through the creating client.
+type WorkerHandle struct {
+	URL string // Worker location, eg "cv40:/client/jobs/1", moved on file splits
+
+	client ContextCaller
+	last   Worker
+	mu     sync.Mutex
+}
+
+// CreateFileWorker creates a worker writing source to files, eg
+// CreateFileWorker(ctx, client, "cv40:/0/camera/0", VideoFileWorker{...})
+func CreateFileWorker(ctx context.Context, c ContextCaller, source string, body any) (*WorkerHandle, error) {
+	return createWorker(ctx, c, strings.TrimSuffix(source, "/")+"/file", body)
+}
+
+// CreateDataWorker creates a worker streaming source packets, eg
+// CreateDataWorker(ctx, client, "cv40:/0/camera/0", ImageDataWorker{...})
+func CreateDataWorker(ctx context.Context, c ContextCaller, source string, body any) (*WorkerHandle, error) {
+	return createWorker(ctx, c, strings.TrimSuffix(source, "/")+"/data", body)
+}
+
+// The agent answers a worker creation with a redirect to its location
+func createWorker(ctx context.Context, c ContextCaller, location string, body any) (*WorkerHandle, error) {
+	err := c.PostContext(ctx, location, body, nil)
+	if !errors.Is(err, ErrRedirect) {
+		if err == nil {
+			err = errors.New("worker creation: no redirect")
+		}
+		return nil, err
+	}
+	return &WorkerHandle{URL: RedirectLocation(err), client: c}, nil
+}
+
+func (h *WorkerHandle) Start(ctx context.Context) error {
+	return h.client.PostContext(ctx, h.location()+"/start", nil, nil)
+}
+
+func (h *WorkerHandle) Pause(ctx context.Context) error {
+	return h.client.PostContext(ctx, h.location()+"/pause", nil, nil)
+}
+
+// Stop the worker, the remaining packets are still served until EOF
+func (h *WorkerHandle) Stop(ctx context.Context) error {
+	return h.client.PostContext(ctx, h.location()+"/stop", nil, nil)
+}
+
+// Discard stops a worker left before its end, eg after a first frame, and
+// drains its remaining packets so the agent and a pooled client free it
+func (h *WorkerHandle) Discard(ctx context.Context) error {
+	if err := h.Stop(ctx); err != nil && !errors.Is(err, EOF) {
+		return err
+	}
+	_, err := h.Wait(ctx)
+	return err
+}
+
+// Status polls the worker, the packets of the response are released. EOF is
+// returned once the worker ended.
+func (h *WorkerHandle) Status(ctx context.Context) (string, error) {
+	worker, err := h.poll(ctx)
+	if err != nil {
+		return "", err
+	}
+	for i := range worker.Packets {
+		worker.Packets[i].Close()
+	}
+	return worker.Status, nil
+}
+
+// Wait polls the worker until it ends, releasing its packets, and returns its
+// last state
+func (h *WorkerHandle) Wait(ctx context.Context) (Worker, error) {
+	for _, err := range h.Packets(ctx) {
+		if err != nil {
+			return h.Worker(), err
+		}
+	}
+	return h.Worker(), nil
+}
+
+// Packets long-polls the worker and yields each packet, which is closed once
+// the loop body returns. File splits redirect the worker to the next file,
+// the polls follow. The sequence ends on EOF, other errors are yielded once
+// before ending.
+func (h *WorkerHandle) Packets(ctx context.Context) iter.Seq2[Packet, error] {
+	return func(yield func(Packet, error) bool) {
+		for {
+			worker, err := h.poll(ctx)
+			if errors.Is(err, EOF) {
+				return
+			}
+			if err != nil {
+				yield(Packet{}, err)
+				return
+			}
+			for i := range worker.Packets {
+				more := yield(worker.Packets[i], nil)
+				worker.Packets[i].Close()
+				if !more {
+					for _, p := range worker.Packets[i+1:] {
+						p.Close()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// Worker returns the last polled state, without packets
+func (h *WorkerHandle) Worker() Worker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
+
+func (h *WorkerHandle) location() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.URL
+}
+
+// Poll the worker, following the redirect to the next file after a split
+func (h *WorkerHandle) poll(ctx context.Context) (Worker, error) {
+	for {
+		var worker Worker
+		location := h.location()
+		err := h.client.GetContext(ctx, location, &worker)
+		if next := RedirectLocation(err); next != "" && next != location {
+			h.mu.Lock()
+			h.URL = next
+			h.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return worker, err
+		}
+		h.mu.Lock()
+		h.last = worker
+		h.last.Packets = nil
+		h.mu.Unlock()
+		return worker, nil
+	}
+}
@@ -0,0 +1,155 @@
+package lt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+)
+
+// Packets are served base64 encoded until the worker ends
+func TestWorkerPackets(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	srv.OnWorker(func(w *lttest.Worker) {
+		go func() {
+			w.Push(lttest.Packet{Data: []byte("frame 1")}, lttest.Packet{Data: []byte("frame 2")})
+			w.Push(lttest.Packet{Data: []byte("frame 3")})
+			w.End()
+		}()
+	})
+	var client lt.Client
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h, err := lt.CreateDataWorker(ctx, &client, srv.URL("/0/camera/0"), lt.ImageDataWorker{Media: "image/yuv422"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.URL != srv.URL("/client/jobs/1") {
+		t.Errorf("worker url %q, want %q", h.URL, srv.URL("/client/jobs/1"))
+	}
+	var got []string
+	for p, err := range h.Packets(ctx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Media != "image/yuv422" {
+			t.Errorf("packet media %q, want image/yuv422", p.Media)
+		}
+		got = append(got, string(p.Data))
+	}
+	if len(got) != 3 || got[0] != "frame 1" || got[2] != "frame 3" {
+		t.Errorf("packets %q, want frame 1 to 3", got)
+	}
+	if status := h.Worker().Status; status != "completed" {
+		t.Errorf("worker status %q, want completed", status)
+	}
+}
+
+// Stopped workers serve their remaining packets, then EOF
+func TestWorkerStop(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	var client lt.Client
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h, err := lt.CreateFileWorker(ctx, &client, srv.URL("/0/camera/0"), lt.VideoFileWorker{Media: "video/mp4", Location: "/data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	w := srv.Workers()[0]
+	w.SetName("rec.mp4")
+	w.Push(lttest.Packet{Data: make([]byte, 100)})
+	if err := h.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	last, err := h.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Name != "rec.mp4" || last.Length != 100 {
+		t.Errorf("last state %q %d bytes, want rec.mp4 100 bytes", last.Name, last.Length)
+	}
+	if _, err := h.Status(ctx); !errors.Is(err, lt.EOF) {
+		t.Errorf("status of an ended worker: %v, want EOF", err)
+	}
+}
+
+// Agent error strings are classified
+func TestWorkerErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind lt.ErrorKind
+		is   error
+	}{
+		{lt.ErrUpdating, lt.KindUpdating, lt.ErrUpdating},
+		{lt.ErrClosed, lt.KindClosed, lt.ErrClosed},
+		{lt.EOF, lt.KindEOF, lt.EOF},
+		{lttest.ErrNotFound, lt.KindNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			srv := lttest.NewServer()
+			defer srv.Close()
+			srv.Fail("POST", "/0/camera/0/data", tt.err)
+			var client lt.Client
+			defer client.Close()
+
+			_, err := lt.CreateDataWorker(context.Background(), &client, srv.URL("/0/camera/0"), lt.ImageDataWorker{Media: "image/yuv422"})
+			if kind := lt.ErrorKindOf(err); kind != tt.kind {
+				t.Errorf("kind %v, want %v: %v", kind, tt.kind, err)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("%v is not %v", err, tt.is)
+			}
+		})
+	}
+}
+
+// Polls follow the worker to its next file after a split
+func TestWorkerSplit(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	client := lt.NewPooledClient(lt.PoolConfig{})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h, err := lt.CreateFileWorker(ctx, client, srv.URL("/0/camera/0"), lt.VideoFileWorker{Media: "video/mp4", Location: "/data", SplitSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := srv.Workers()[0]
+	go func() {
+		w.SetName("rec-1.mp4")
+		w.Push(lttest.Packet{Data: make([]byte, 100)})
+		time.Sleep(100 * time.Millisecond)
+		w.Split("rec-2.mp4")
+		w.Push(lttest.Packet{Data: make([]byte, 50)})
+		w.End()
+	}()
+
+	var names []string
+	for _, err := range h.Packets(ctx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Worker().Name)
+	}
+	if len(names) != 2 || names[0] != "rec-1.mp4" || names[1] != "rec-2.mp4" {
+		t.Errorf("packets of files %q, want rec-1.mp4 then rec-2.mp4", names)
+	}
+	if h.URL != srv.URL("/client/jobs/2") {
+		t.Errorf("worker url %q after the split, want %q", h.URL, srv.URL("/client/jobs/2"))
+	}
+}
@@ -0,0 +1,70 @@
+package lttest
+
+import (
+	lt "lt/client/go"
+)
+
+// Defaults returns the resources of a CV40 board with a locked 1080p60 camera
+// on board 0 and an idle HDMI output and canvas
+func Defaults() map[string]any {
+	video := lt.VideoSignal{
+		Description: "camera",
+		Format:      "yuv422",
+		Signal:      "locked",
+		Size:        [2]int{1920, 1080},
+		Framerate:   60,
+	}
+	audio := lt.AudioSignal{
+		Description: "camera",
+		Format:      "pcm",
+		Signal:      "none",
+	}
+	return map[string]any{
+		"/":  lt.Agent{Version: lt.APIVersion, Revision: "lttest"},
+		"/0": lt.Board{Model: "CV40"},
+		"/0/buttons": lt.Buttons{Buttons: []lt.Button{
+			{Description: "button 0"},
+			{Description: "button 1"},
+		}},
+		"/0/camera/0": lt.Camera{Model: "CV40", Audio: audio, Video: video},
+		"/0/camera/0/exposure": lt.CameraExposure{
+			Framerate:     60,
+			IsAuto:        true,
+			Shutter:       16.6,
+			Gain:          1,
+			Binning:       1,
+			LowLightGain:  1,
+			Level:         0.5,
+			Speed:         0.5,
+			MaxSaturation: 0.1,
+
+			ShutterLimits:      [2]float64{0.01, 16.6},
+			GainLimits:         [2]float64{1, 64},
+			BinningLimits:      [2]float64{1, 1},
+			LowLightGainLimits: [2]float64{1, 8},
+
+			Window: [4]int{0, 0, 1920, 1080},
+		},
+		"/0/camera/0/white": lt.CameraWhite{
+			Balance:     [3]float64{1, 1, 1},
+			Temperature: 5600,
+		},
+		"/0/camera/0/colors": lt.CameraColors{
+			Gamma:     1,
+			ColorGain: [3]float64{1, 1, 1},
+		},
+		"/0/camera/0/visuals": lt.CameraVisuals{
+			Flip:      "none",
+			Zoom:      1,
+			Sharpness: 1,
+		},
+		"/0/hdmi-out/0": lt.Output{
+			Format: "auto",
+			Link:   "connected",
+			Video:  video,
+		},
+		"/canvas/0": lt.Input{
+			Video: lt.VideoSignal{Description: "canvas", Signal: "none"},
+		},
+	}
+}
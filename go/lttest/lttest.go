@@ -0,0 +1,615 @@
+// Package lttest provides an in-process fake LT agent for tests.
+//
+// The server speaks the agent newline-delimited JSON protocol on a temporary
+// unix socket or TCP port, so any lt.Client can be pointed at it:
+//
+//	srv := lttest.NewServer()
+//	defer srv.Close()
+//	var client lt.Client
+//	err := client.Get(srv.URL("/0/camera/0"), &camera)
+package lttest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lt "lt/client/go"
+)
+
+// Request received by the server
+type Request struct {
+	Method string
+	URL    string
+	Path   string // Agent relative path, eg "/0/camera/0/colors"
+	Body   json.RawMessage
+	Client int // Connection which sent the request
+}
+
+// HandlerFunc answers a request, the response is JSON encoded. Errors are sent
+// as agent error strings, see Redirect for worker locations.
+type HandlerFunc func(req *Request) (any, error)
+
+// Redirect error, answered as {"error": "redirect", "location": location}
+func Redirect(location string) error {
+	return &redirectError{location}
+}
+
+type redirectError struct {
+	location string
+}
+
+func (e *redirectError) Error() string {
+	return lt.ErrRedirect.Error() + ": " + e.location
+}
+
+// ErrNotFound is answered for unknown resources
+var ErrNotFound = errors.New("not found")
+
+type Server struct {
+	Scheme   string        // URL scheme of the fake agent
+	Listener net.Listener  // Unix socket or TCP listener
+	Poll     time.Duration // Worker long-poll timeout (default 50ms)
+
+	base      string
+	resources map[string]json.RawMessage
+	handlers  map[string]HandlerFunc
+	workers   map[string]*Worker
+	requests  []Request
+	onWorker  func(w *Worker)
+	clients   int
+	jobs      int
+	conns     map[net.Conn]bool
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+}
+
+var servers atomic.Int32
+
+// NewServer starts a fake agent on a temporary unix socket, loaded with the
+// Defaults resources
+func NewServer() *Server {
+	scheme := fmt.Sprintf("lttest%d%d", os.Getpid(), servers.Add(1))
+	name := path.Join(os.TempDir(), scheme+".sock")
+	os.Remove(name)
+	l, err := net.Listen("unix", name)
+	if err != nil {
+		panic("lttest: listen: " + err.Error())
+	}
+	base := scheme + ":"
+	if runtime.GOOS == "windows" {
+		base = scheme + "://unix"
+	}
+	return start(scheme, base, l)
+}
+
+// NewTCPServer starts a fake agent on a local TCP port, reached with the tcp
+// scheme
+func NewTCPServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("lttest: listen: " + err.Error())
+	}
+	return start("tcp", "tcp://"+l.Addr().String(), l)
+}
+
+func start(scheme, base string, l net.Listener) *Server {
+	s := &Server{
+		Scheme:    scheme,
+		Listener:  l,
+		Poll:      50 * time.Millisecond,
+		base:      base,
+		resources: map[string]json.RawMessage{},
+		handlers:  map[string]HandlerFunc{},
+		workers:   map[string]*Worker{},
+		conns:     map[net.Conn]bool{},
+	}
+	for p, v := range Defaults() {
+		s.Set(p, v)
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// URL of an agent path, eg URL("/0/camera/0")
+func (s *Server) URL(p string) string {
+	return s.base + "/" + strings.TrimPrefix(p, "/")
+}
+
+// Agent root for the resource navigator, eg lt.At(srv.Agent())
+func (s *Server) Agent() string {
+	return s.base
+}
+
+// Close the listener and all client connections
+func (s *Server) Close() {
+	s.Listener.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	for _, w := range s.workers {
+		w.End()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	if addr, ok := s.Listener.Addr().(*net.UnixAddr); ok {
+		os.Remove(addr.Name)
+	}
+}
+
+// Disconnect closes the client connections, like an agent restart, the
+// server keeps accepting new ones. The workers of the clients end.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+}
+
+// Set a resource answered on GET and updated on POST, the value is stored as
+// JSON. POST bodies are merged into the stored object, like the agent does.
+func (s *Server) Set(p string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic("lttest: resource: " + err.Error())
+	}
+	s.mu.Lock()
+	s.resources[clean(p)] = b
+	s.mu.Unlock()
+}
+
+// Resource decodes a stored resource into v
+func (s *Server) Resource(p string, v any) error {
+	s.mu.Lock()
+	b, ok := s.resources[clean(p)]
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Handle overrides a method and path, it takes precedence over resources and
+// workers. Use "*" as method to match any.
+func (s *Server) Handle(method, p string, fn HandlerFunc) {
+	s.mu.Lock()
+	s.handlers[method+" "+clean(p)] = fn
+	s.mu.Unlock()
+}
+
+// Fail answers a method and path with err, eg lt.ErrUpdating
+func (s *Server) Fail(method, p string, err error) {
+	s.Handle(method, p, func(*Request) (any, error) { return nil, err })
+}
+
+// OnWorker is called with each new worker, before the creation is answered
+func (s *Server) OnWorker(fn func(w *Worker)) {
+	s.mu.Lock()
+	s.onWorker = fn
+	s.mu.Unlock()
+}
+
+// Requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Workers created so far
+func (s *Server) Workers() []*Worker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	workers := make([]*Worker, 0, len(s.workers))
+	for i := 1; i <= s.jobs; i++ {
+		location := "/client/jobs/" + strconv.Itoa(i)
+		// Split workers are listed at their last location
+		if w, ok := s.workers[location]; ok && w.location() == location {
+			workers = append(workers, w)
+		}
+	}
+	return workers
+}
+
+//
+// Protocol
+//
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.clients++
+		id := s.clients
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(conn, id)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn, id int) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		// The agent collects the workers of a gone client
+		for location, w := range s.workers {
+			if w.client == id {
+				w.End()
+				delete(s.workers, location)
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+	for {
+		var request struct {
+			Method string          `json:"method"`
+			URL    string          `json:"url"`
+			Body   json.RawMessage `json:"body"`
+		}
+		if err := decoder.Decode(&request); err != nil {
+			return
+		}
+		req := &Request{
+			Method: request.Method,
+			URL:    request.URL,
+			Body:   request.Body,
+			Client: id,
+		}
+		if u, err := url.Parse(request.URL); err == nil {
+			req.Path = clean(u.Path)
+		}
+		if string(req.Body) == "null" {
+			req.Body = nil
+		}
+		if err := encoder.Encode(s.answer(req)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) answer(req *Request) any {
+	s.mu.Lock()
+	s.requests = append(s.requests, *req)
+	s.mu.Unlock()
+
+	response, err := s.route(req)
+	switch e := err.(type) {
+	case nil:
+		if response == nil {
+			return struct{}{}
+		}
+		return response
+	case *redirectError:
+		return map[string]string{"error": lt.ErrRedirect.Error(), "location": e.location}
+	default:
+		return map[string]string{"error": e.Error()}
+	}
+}
+
+func (s *Server) route(req *Request) (any, error) {
+	s.mu.Lock()
+	fn, ok := s.handlers[req.Method+" "+req.Path]
+	if !ok {
+		fn, ok = s.handlers["* "+req.Path]
+	}
+	s.mu.Unlock()
+	if ok {
+		return fn(req)
+	}
+
+	// Workers
+	if strings.HasPrefix(req.Path, "/client/") {
+		return s.client(req)
+	}
+	if req.Method == "POST" && (strings.HasSuffix(req.Path, "/data") || strings.HasSuffix(req.Path, "/file")) {
+		return nil, Redirect(s.URL(s.create(req).Path))
+	}
+
+	// Resources
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.resources[req.Path]
+	switch req.Method {
+	case "GET":
+		if !ok {
+			return nil, ErrNotFound
+		}
+		return stored, nil
+	case "POST":
+		if !ok {
+			// Operations, eg canvas drawing, are only recorded
+			return nil, nil
+		}
+		merged, err := merge(stored, req.Body)
+		if err != nil {
+			return nil, err
+		}
+		s.resources[req.Path] = merged
+		return merged, nil
+	case "DELETE":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown method: %s", req.Method)
+	}
+}
+
+func (s *Server) client(req *Request) (any, error) {
+	// Shared memory references
+	if strings.HasPrefix(req.Path, "/client/ref/") || strings.HasPrefix(req.Path, "/client/refs/") {
+		return nil, nil
+	}
+
+	// Workers are owned by the client which created them
+	location, action := req.Path, ""
+	s.mu.Lock()
+	w, ok := s.workers[location]
+	if !ok {
+		location, action = path.Dir(req.Path), path.Base(req.Path)
+		w, ok = s.workers[location]
+	}
+	s.mu.Unlock()
+	if !ok || w.client != req.Client {
+		return nil, ErrNotFound
+	}
+
+	// Split workers redirect to their next location
+	if next := w.location(); next != location && req.Method == "GET" && action == "" {
+		s.mu.Lock()
+		delete(s.workers, location)
+		s.mu.Unlock()
+		return nil, Redirect(s.URL(next))
+	}
+
+	switch {
+	case req.Method == "GET" && action == "":
+		return w.poll(s.Poll)
+	case req.Method == "POST" && action == "start":
+		w.setStatus("running")
+	case req.Method == "POST" && action == "pause":
+		w.setStatus("paused")
+	case req.Method == "POST" && action == "stop":
+		w.End()
+	case req.Method == "DELETE" && action == "":
+		w.End()
+	default:
+		return nil, ErrNotFound
+	}
+	return nil, nil
+}
+
+func (s *Server) create(req *Request) *Worker {
+	var body struct {
+		Media string `json:"media"`
+	}
+	json.Unmarshal(req.Body, &body)
+
+	s.mu.Lock()
+	s.jobs++
+	w := &Worker{
+		Path:   "/client/jobs/" + strconv.Itoa(s.jobs),
+		Source: req.URL,
+		Media:  body.Media,
+		Body:   req.Body,
+		status: "running",
+		client: req.Client,
+		server: s,
+		start:  time.Now(),
+		notify: make(chan struct{}, 1),
+	}
+	s.workers[w.Path] = w
+	onWorker := s.onWorker
+	s.mu.Unlock()
+
+	if onWorker != nil {
+		onWorker(w)
+	}
+	return w
+}
+
+//
+// Workers
+//
+
+// Packet served by a worker, Data is sent base64 encoded
+type Packet struct {
+	Track     int    `json:"track"`
+	Media     string `json:"media"`
+	Signal    string `json:"signal"`
+	Timestamp int64  `json:"timestamp"`
+	Data      []byte `json:"data"`
+	Meta      any    `json:"meta"`
+}
+
+type Worker struct {
+	Path   string          // Agent relative location, eg "/client/jobs/1", see Split
+	Source string          // Creation url, eg "cv40:/0/camera/0/data"
+	Media  string          // Requested media
+	Body   json.RawMessage // Creation request body
+
+	name    string
+	status  string
+	client  int
+	server  *Server
+	start   time.Time
+	length  int
+	packets []Packet
+	ended   bool
+	notify  chan struct{}
+	mu      sync.Mutex
+}
+
+// Push packets served on the next worker GET
+func (w *Worker) Push(packets ...Packet) {
+	w.mu.Lock()
+	for i := range packets {
+		if packets[i].Media == "" {
+			packets[i].Media = w.Media
+		}
+		if packets[i].Signal == "" {
+			packets[i].Signal = "locked"
+		}
+		if packets[i].Timestamp == 0 {
+			packets[i].Timestamp = time.Now().UnixMicro()
+		}
+		w.length += len(packets[i].Data)
+	}
+	w.packets = append(w.packets, packets...)
+	w.mu.Unlock()
+	w.wake()
+}
+
+// SetName sets the file name reported by a file worker
+func (w *Worker) SetName(name string) {
+	w.mu.Lock()
+	w.name = name
+	w.mu.Unlock()
+}
+
+// Split moves the worker to its next file, named name, at a new location:
+// the next GET of the current one answers a redirect, like the agent does on
+// a split
+func (w *Worker) Split(name string) {
+	s := w.server
+	s.mu.Lock()
+	s.jobs++
+	next := "/client/jobs/" + strconv.Itoa(s.jobs)
+	s.workers[next] = w
+	s.mu.Unlock()
+
+	w.mu.Lock()
+	w.Path = next
+	w.name = name
+	w.length = 0
+	w.mu.Unlock()
+	w.wake()
+}
+
+func (w *Worker) location() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Path
+}
+
+// End the stream, GET answers EOF once the pushed packets are served
+func (w *Worker) End() {
+	w.mu.Lock()
+	w.ended = true
+	w.status = "completed"
+	w.mu.Unlock()
+	w.wake()
+}
+
+// Status of the worker: running, paused or completed
+func (w *Worker) Status() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *Worker) setStatus(status string) {
+	w.mu.Lock()
+	if !w.ended {
+		w.status = status
+	}
+	w.mu.Unlock()
+}
+
+func (w *Worker) wake() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Long-poll the pending packets
+func (w *Worker) poll(timeout time.Duration) (any, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		w.mu.Lock()
+		if len(w.packets) > 0 || w.ended {
+			break
+		}
+		w.mu.Unlock()
+		select {
+		case <-w.notify:
+		case <-timer.C:
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			return w.response(), nil
+		}
+	}
+	defer w.mu.Unlock()
+	if len(w.packets) == 0 {
+		return nil, io.EOF
+	}
+	return w.response(), nil
+}
+
+// Worker answer, consuming the pending packets
+func (w *Worker) response() any {
+	packets := w.packets
+	if packets == nil {
+		packets = []Packet{}
+	}
+	w.packets = nil
+	return map[string]any{
+		"name":     w.name,
+		"location": w.Path,
+		"start":    w.start.UnixMicro(),
+		"duration": time.Since(w.start).Microseconds(),
+		"length":   w.length,
+		"status":   w.status,
+		"packets":  packets,
+	}
+}
+
+//
+// Helpers
+//
+
+func clean(p string) string {
+	return path.Clean("/" + p)
+}
+
+// Merge a JSON object body into a stored object
+func merge(stored, body json.RawMessage) (json.RawMessage, error) {
+	if len(body) == 0 {
+		return stored, nil
+	}
+	var dst, src map[string]json.RawMessage
+	if err := json.Unmarshal(stored, &dst); err != nil {
+		return body, nil
+	}
+	if err := json.Unmarshal(body, &src); err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return json.Marshal(dst)
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -47,11 +47,11 @@ func main() {
 	}
 
 	// Create worker
-	err = client.Post(sourceURL+"/file", lt.VideoFileWorker{Media: "video/mp4", Location: wd}, nil)
-	if !errors.Is(err, lt.ErrRedirect) {
+	ctx := context.Background()
+	worker, err := lt.CreateFileWorker(ctx, &client, sourceURL, lt.VideoFileWorker{Media: "video/mp4", Location: wd})
+	if err != nil {
 		log.Fatal("worker creation failed:", err)
 	}
-	workerURL := lt.RedirectLocation(err)
 
 	// Allow terminal keyboard events
 	state, err := term.MakeRaw(int(os.Stdin.Fd()))
@@ -61,88 +61,67 @@ func main() {
 	defer term.Restore(int(os.Stdin.Fd()), state)
 
 	// Capture keyboard events
-	events := make(chan byte, 1)
 	go func() {
+		var paused bool
 		reader := bufio.NewReader(os.Stdin)
 		for {
 			c, err := reader.ReadByte()
 			if err != nil {
 				log.Fatal(err)
 			}
+			switch c {
 			// Ctrl+C
-			if c == 0x03 {
+			case 0x03:
 				fmt.Println("")
 				os.Exit(0)
-			}
-			// Forward event
-			events <- c
-		}
-	}()
 
-	var paused bool
-	for {
-		select {
-		case c := <-events:
-			switch c {
 			// Start/Pause (space key)
 			case ' ':
 				if paused {
-					// Start
-					if err := client.Post(workerURL+"/start", nil, nil); err != nil {
-						log.Fatal(err)
-					}
-					paused = false
+					err = worker.Start(ctx)
 				} else {
-					// Pause
-					if err := client.Post(workerURL+"/pause", nil, nil); err != nil {
-						log.Fatal(err)
-					}
-					paused = true
+					err = worker.Pause(ctx)
 				}
+				if err != nil {
+					log.Fatal(err)
+				}
+				paused = !paused
 
 			// Stop (any other key)
 			default:
 				fmt.Println("stop")
-				if err := client.Post(workerURL+"/stop", nil, nil); err != nil {
+				if err := worker.Stop(ctx); err != nil {
 					log.Fatal(err)
 				}
 			}
+		}
+	}()
 
-		default:
-			// Fetch worker response
-			var worker lt.Worker
-			if err := client.Get(workerURL, &worker); err != nil {
-				log.Fatal(err)
+	// Loop over written packets, released once the loop body returns
+	for packet, err := range worker.Packets(ctx) {
+		if err != nil {
+			log.Fatal(err)
+		}
+		info := worker.Worker()
+		switch strings.Split(packet.Media, "/")[0] {
+		// Parse audio data
+		case "audio":
+			var meta lt.AudioMetadata
+			if err := json.Unmarshal(packet.Meta, &meta); err != nil {
+				log.Fatal("worker packet metadata:", err)
 			}
+			fmt.Printf("%s audio #%d  chan %d rate %d - %d bytes\n", info.Name, packet.Track, meta.Channels, meta.Samplerate, info.Length)
 
-			// Loop over written packets
-			for _, packet := range worker.Packets {
-				switch strings.Split(packet.Media, "/")[0] {
-				// Parse audio data
-				case "audio":
-					var meta lt.AudioMetadata
-					if err := json.Unmarshal(packet.Meta, &meta); err != nil {
-						log.Fatal("worker packet metadata:", err)
-					}
-					fmt.Printf("%s audio #%d  chan %d rate %d - %d bytes\n", worker.Name, packet.Track, meta.Channels, meta.Samplerate, worker.Length)
-
-				// Parse video data
-				case "video":
-					var meta lt.VideoMetadata
-					if err := json.Unmarshal(packet.Meta, &meta); err != nil {
-						log.Fatal("worker packet metadata:", err)
-					}
-					fmt.Printf("\r%s %s %dx%d %d bytes", sourceURL, worker.Name, meta.Size[0], meta.Size[1], worker.Length)
-
-				default:
-					log.Fatal("unknown type: ", packet.Media)
-				}
-
-				// Release packet
-				if err := packet.Close(); err != nil {
-					log.Fatal(err)
-				}
+		// Parse video data
+		case "video":
+			var meta lt.VideoMetadata
+			if err := json.Unmarshal(packet.Meta, &meta); err != nil {
+				log.Fatal("worker packet metadata:", err)
 			}
+			fmt.Printf("\r%s %s %dx%d %d bytes", sourceURL, info.Name, meta.Size[0], meta.Size[1], info.Length)
+
+		default:
+			log.Fatal("unknown type: ", packet.Media)
 		}
 	}
 }
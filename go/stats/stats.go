@@ -0,0 +1,208 @@
+// Package stats computes image statistics of video frames: channel
+// histograms, luma mean and percentiles, clipping ratios and color cast, over
+// a region of interest such as the auto exposure window.
+package stats
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+type Options struct {
+	ROI       image.Rectangle // Region of interest, the whole image if empty
+	Bins      int             // Histogram bins, 256 by default
+	Shadow    *uint8          // Luma at or below which shadows clip, 4 if nil, see Level
+	Highlight uint8           // Luma at or above which highlights clip, 251 by default
+}
+
+// Level returns a luma threshold for Options, eg Shadow: Level(0) to count
+// only black pixels as clipped shadows
+func Level(luma uint8) *uint8 {
+	return &luma
+}
+
+func (o Options) withDefaults(bounds image.Rectangle) Options {
+	if o.ROI.Empty() {
+		o.ROI = bounds
+	}
+	o.ROI = o.ROI.Intersect(bounds)
+	if o.Bins <= 0 || o.Bins > 256 {
+		o.Bins = 256
+	}
+	if o.Shadow == nil {
+		o.Shadow = Level(4)
+	}
+	if o.Highlight == 0 {
+		o.Highlight = 251
+	}
+	return o
+}
+
+// Channel statistics of 8 bit samples
+type Channel struct {
+	Histogram []int   `json:"histogram"` // Bins of equal width over [0 .. 255]
+	Mean      float64 `json:"mean"`
+	P5        uint8   `json:"p5"`
+	Median    uint8   `json:"median"`
+	P95       uint8   `json:"p95"`
+
+	counts [256]int
+	n      int
+}
+
+// Percentile returns the sample value below which q (0 .. 1) of the samples fall
+func (c *Channel) Percentile(q float64) uint8 {
+	rank := int(math.Ceil(q * float64(c.n)))
+	sum := 0
+	for v, n := range c.counts {
+		sum += n
+		if sum >= rank && sum > 0 {
+			return uint8(v)
+		}
+	}
+	return 255
+}
+
+func (c *Channel) add(v uint8) {
+	c.counts[v]++
+	c.n++
+}
+
+func (c *Channel) finish(bins int) {
+	c.Histogram = make([]int, bins)
+	sum := 0
+	for v, n := range c.counts {
+		c.Histogram[v*bins/256] += n
+		sum += v * n
+	}
+	if c.n > 0 {
+		c.Mean = float64(sum) / float64(c.n)
+	}
+	c.P5, c.Median, c.P95 = c.Percentile(0.05), c.Percentile(0.5), c.Percentile(0.95)
+}
+
+// Cast is the gray world color cast estimate: the mean channels of the
+// unclipped pixels, and the gains neutralizing them relative to green
+type Cast struct {
+	Mean  [3]float64 `json:"mean"`  // Red, green, blue
+	Gains [3]float64 `json:"gains"` // Red, green (1), blue
+	Tint  string     `json:"tint"`  // Dominant tint, eg "red", or "neutral"
+}
+
+type Stats struct {
+	ROI        [4]int  `json:"roi"` // x, y, width, height
+	Pixels     int     `json:"pixels"`
+	Luma       Channel `json:"luma"`
+	Red        Channel `json:"red"`
+	Green      Channel `json:"green"`
+	Blue       Channel `json:"blue"`
+	Shadows    float64 `json:"shadows"`    // Ratio of pixels with clipped shadows
+	Highlights float64 `json:"highlights"` // Ratio of pixels with clipped highlights
+	Cast       Cast    `json:"cast"`
+}
+
+// Compute returns the statistics of img over the options region of interest.
+// *image.YCbCr frames use their luma plane, other images BT.601 luma.
+func Compute(img image.Image, opts Options) Stats {
+	opts = opts.withDefaults(img.Bounds())
+	shadow := *opts.Shadow
+	r := opts.ROI
+	s := Stats{ROI: [4]int{r.Min.X, r.Min.Y, r.Dx(), r.Dy()}}
+	var sum [3]float64
+	unclipped := 0
+	add := func(y, red, green, blue uint8) {
+		s.Luma.add(y)
+		s.Red.add(red)
+		s.Green.add(green)
+		s.Blue.add(blue)
+		switch {
+		case y <= shadow:
+			s.Shadows++
+		case y >= opts.Highlight:
+			s.Highlights++
+		default:
+			sum[0] += float64(red)
+			sum[1] += float64(green)
+			sum[2] += float64(blue)
+			unclipped++
+		}
+	}
+
+	switch img := img.(type) {
+	case *image.YCbCr:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				yi, ci := img.YOffset(x, y), img.COffset(x, y)
+				red, green, blue := color.YCbCrToRGB(img.Y[yi], img.Cb[ci], img.Cr[ci])
+				add(img.Y[yi], red, green, blue)
+			}
+		}
+	case *image.RGBA:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				p := img.Pix[img.PixOffset(x, y):]
+				add(luma(p[0], p[1], p[2]), p[0], p[1], p[2])
+			}
+		}
+	default:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				add(luma(c.R, c.G, c.B), c.R, c.G, c.B)
+			}
+		}
+	}
+
+	s.Pixels = s.Luma.n
+	for _, c := range []*Channel{&s.Luma, &s.Red, &s.Green, &s.Blue} {
+		c.finish(opts.Bins)
+	}
+	if s.Pixels > 0 {
+		s.Shadows /= float64(s.Pixels)
+		s.Highlights /= float64(s.Pixels)
+	}
+	s.Cast = cast(sum, unclipped)
+	return s
+}
+
+func luma(r, g, b uint8) uint8 {
+	return uint8((299*int(r) + 587*int(g) + 114*int(b) + 500) / 1000)
+}
+
+// Tints deviating less than 5% from neutral are not reported
+func cast(sum [3]float64, n int) Cast {
+	c := Cast{Gains: [3]float64{1, 1, 1}, Tint: "neutral"}
+	if n == 0 {
+		return c
+	}
+	for i := range sum {
+		c.Mean[i] = sum[i] / float64(n)
+	}
+	if c.Mean[0] == 0 || c.Mean[1] == 0 || c.Mean[2] == 0 {
+		return c
+	}
+	c.Gains = [3]float64{c.Mean[1] / c.Mean[0], 1, c.Mean[1] / c.Mean[2]}
+
+	gray := (c.Mean[0] + c.Mean[1] + c.Mean[2]) / 3
+	names := [3]string{"red", "green", "blue"}
+	best := 0.05
+	for i, m := range c.Mean {
+		if d := m/gray - 1; d > best {
+			best, c.Tint = d, names[i]
+		}
+	}
+	return c
+}
+
+// Window returns the rectangle of a {x, y, width, height} window, eg
+// CameraExposure.Window, scaled from a from sized frame to a to sized one
+func Window(window [4]int, from, to [2]int) image.Rectangle {
+	r := image.Rect(window[0], window[1], window[0]+window[2], window[1]+window[3])
+	if from[0] <= 0 || from[1] <= 0 || from == to {
+		return r
+	}
+	sx := func(v int) int { return v * to[0] / from[0] }
+	sy := func(v int) int { return v * to[1] / from[1] }
+	return image.Rect(sx(r.Min.X), sy(r.Min.Y), sx(r.Max.X), sy(r.Max.Y))
+}
@@ -0,0 +1,29 @@
+package stats
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestShadow(t *testing.T) {
+	// Lumas 0, 2, 4 and 128
+	img := image.NewGray(image.Rect(0, 0, 4, 1))
+	for x, y := range []uint8{0, 2, 4, 128} {
+		img.SetGray(x, 0, color.Gray{Y: y})
+	}
+	tests := []struct {
+		name   string
+		shadow *uint8
+		want   float64
+	}{
+		{"default", nil, 0.75},
+		{"zero", Level(0), 0.25},
+		{"2", Level(2), 0.5},
+	}
+	for _, tt := range tests {
+		if s := Compute(img, Options{Shadow: tt.shadow}); s.Shadows != tt.want {
+			t.Errorf("%s: shadows %v, want %v", tt.name, s.Shadows, tt.want)
+		}
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -43,31 +43,27 @@ func main() {
 	}
 
 	// Create worker
-	err = client.Post(sourceURL+"/file", lt.ImageFileWorker{Media: "image/jpeg", Location: wd}, nil)
-	if !errors.Is(err, lt.ErrRedirect) {
+	worker, err := lt.CreateFileWorker(context.Background(), &client, sourceURL, lt.ImageFileWorker{Media: "image/jpeg", Location: wd})
+	if err != nil {
 		log.Fatal("worker creation failed:", err)
 	}
-	workerURL := lt.RedirectLocation(err)
 
-	// Fetch worker response
-	var worker lt.Worker
-	if err := client.Get(workerURL, &worker); err != nil {
-		log.Fatal(err)
-	}
+	// First written packet, released once the loop body returns
+	for packet, err := range worker.Packets(context.Background()) {
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	// Packet data
-	if len(worker.Packets) == 0 {
-		log.Fatal("worker packet: not found")
-	}
-	packet := worker.Packets[0]
-	defer packet.Close() // Packet has to be manually released
+		// Packet metadata
+		var meta lt.ImageMetadata
+		if err := json.Unmarshal(packet.Meta, &meta); err != nil {
+			log.Fatal("worker packet metadata:", err)
+		}
 
-	// Packet metadata
-	var meta lt.ImageMetadata
-	if err := json.Unmarshal(packet.Meta, &meta); err != nil {
-		log.Fatal("worker packet metadata:", err)
+		// Print file information
+		info := worker.Worker()
+		fmt.Printf("%s %s %dx%d %d bytes\n", sourceURL, info.Name, meta.Size[0], meta.Size[1], info.Length)
+		return
 	}
-
-	// Print file information
-	fmt.Printf("%s %s %dx%d %d bytes\n", sourceURL, worker.Name, meta.Size[0], meta.Size[1], worker.Length)
+	log.Fatal("worker packet: not found")
 }
@@ -0,0 +1,170 @@
+package wav
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	lt "lt/client/go"
+)
+
+type Options struct {
+	Dir   string        // Directory of the files, created if missing
+	Name  string        // File name prefix, "audio" by default: audio-001.wav, audio-002.wav...
+	Raw   bool          // Raw PCM .pcm files instead of WAV ones
+	Split time.Duration // Duration of the files, 0 for a single file
+}
+
+// Recorder writes audio packets to files, starting a new file every Split,
+// when the format changes or when a WAV file reaches its 4GB limit
+type Recorder struct {
+	opts   Options
+	format Format
+	file   *os.File
+	wav    *Writer
+	n      int64 // Bytes of the current file
+	files  []string
+}
+
+func NewRecorder(opts Options) *Recorder {
+	if opts.Name == "" {
+		opts.Name = "audio"
+	}
+	return &Recorder{opts: opts}
+}
+
+// WritePacket appends the samples of an audio packet, packets without data,
+// eg while the signal is lost, are skipped
+func (r *Recorder) WritePacket(p lt.Packet) error {
+	data, err := p.Bytes()
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	f, err := FormatOf(p)
+	if err != nil {
+		return err
+	}
+	if r.file != nil && f != r.format {
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+	}
+	r.format = f
+	data = data[:len(data)-len(data)%f.BlockAlign()]
+
+	// Split at the block boundary reaching the limit
+	for len(data) > 0 {
+		if r.file == nil {
+			if err := r.openFile(); err != nil {
+				return err
+			}
+		}
+		n := int64(len(data))
+		if limit := r.limit(); limit > 0 {
+			n = min(n, limit-r.n)
+		}
+		if err := r.write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+		if limit := r.limit(); limit > 0 && r.n >= limit {
+			if err := r.closeFile(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// File size limit in bytes, 0 for none
+func (r *Recorder) limit() int64 {
+	var limit int64
+	if r.opts.Split > 0 {
+		limit = int64(r.opts.Split.Seconds() * float64(r.format.Samplerate))
+		limit = max(limit, 1) * int64(r.format.BlockAlign())
+	}
+	if !r.opts.Raw && (limit == 0 || limit > maxData(r.format)) {
+		limit = maxData(r.format)
+	}
+	return limit
+}
+
+func (r *Recorder) openFile() error {
+	if err := os.MkdirAll(r.opts.Dir, 0o755); err != nil {
+		return err
+	}
+	ext := ".wav"
+	if r.opts.Raw {
+		ext = ".pcm"
+	}
+	name := filepath.Join(r.opts.Dir, fmt.Sprintf("%s-%03d%s", r.opts.Name, len(r.files)+1, ext))
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if !r.opts.Raw {
+		if r.wav, err = NewWriter(file, r.format); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	r.file, r.n = file, 0
+	r.files = append(r.files, name)
+	return nil
+}
+
+func (r *Recorder) write(pcm []byte) error {
+	var err error
+	if r.wav != nil {
+		_, err = r.wav.Write(pcm)
+	} else {
+		_, err = r.file.Write(pcm)
+	}
+	r.n += int64(len(pcm))
+	return err
+}
+
+func (r *Recorder) closeFile() error {
+	var err error
+	if r.wav != nil {
+		err = r.wav.Close()
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file, r.wav = nil, nil
+	return err
+}
+
+// Files returns the files written, in order
+func (r *Recorder) Files() []string { return r.files }
+
+// Format returns the format of the last packet written
+func (r *Recorder) Format() Format { return r.format }
+
+// Close finalizes the current file
+func (r *Recorder) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.closeFile()
+}
+
+// Record writes the packets of an audio data worker until it ends or ctx is
+// done, and returns the files written
+func Record(ctx context.Context, w *lt.WorkerHandle, opts Options) ([]string, error) {
+	r := NewRecorder(opts)
+	for p, err := range w.Packets(ctx) {
+		if err != nil {
+			r.Close()
+			return r.Files(), err
+		}
+		if err := r.WritePacket(p); err != nil {
+			r.Close()
+			return r.Files(), err
+		}
+	}
+	return r.Files(), r.Close()
+}
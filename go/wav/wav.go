@@ -0,0 +1,140 @@
+// Package wav writes the audio packets of a data worker to WAV files, or to
+// raw PCM ones. Packets hold interleaved little endian PCM samples, eg
+// "audio/pcm", of the channels, sample rate and depth (bits per sample) of
+// their metadata.
+package wav
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	lt "lt/client/go"
+)
+
+var ErrFormat = errors.New("wav: invalid audio format")
+
+type Format struct {
+	Channels   int
+	Samplerate int
+	Depth      int // Bits per sample, 8 to 32
+}
+
+// FormatOf returns the format of an audio packet from its metadata
+func FormatOf(p lt.Packet) (Format, error) {
+	var meta lt.AudioMetadata
+	if err := json.Unmarshal(p.Meta, &meta); err != nil {
+		return Format{}, fmt.Errorf("wav: packet metadata: %w", err)
+	}
+	f := Format{Channels: meta.Channels, Samplerate: meta.Samplerate, Depth: meta.Depth}
+	return f, f.validate()
+}
+
+func (f Format) validate() error {
+	if f.Channels <= 0 || f.Samplerate <= 0 || f.Depth <= 0 || f.Depth > 32 || f.Depth%8 != 0 {
+		return fmt.Errorf("%w: %d channels %d Hz %d bits", ErrFormat, f.Channels, f.Samplerate, f.Depth)
+	}
+	return nil
+}
+
+// BlockAlign is the size in bytes of a sample of all channels
+func (f Format) BlockAlign() int { return f.Channels * f.Depth / 8 }
+
+// ByteRate is the size in bytes of a second of audio
+func (f Format) ByteRate() int { return f.Samplerate * f.BlockAlign() }
+
+// Duration of n bytes of audio
+func (f Format) Duration(n int64) time.Duration {
+	return time.Duration(n) * time.Second / time.Duration(f.ByteRate())
+}
+
+//
+// WAV file
+//
+
+const headerSize = 44
+
+// Data size limit of the 32 bit RIFF sizes, in whole blocks
+func maxData(f Format) int64 {
+	n := int64(1<<32-1) - headerSize
+	return n - n%int64(f.BlockAlign())
+}
+
+// Writer writes a WAV file. The header sizes are written on Close, a file not
+// closed still holds its samples, with a header of zero sizes.
+type Writer struct {
+	w      io.WriteSeeker
+	format Format
+	n      int64
+	err    error
+}
+
+func NewWriter(w io.WriteSeeker, f Format) (*Writer, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	wr := &Writer{w: w, format: f}
+	if _, err := w.Write(header(f, 0)); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// Write appends samples, in whole blocks
+func (w *Writer) Write(pcm []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if len(pcm)%w.format.BlockAlign() != 0 {
+		return 0, fmt.Errorf("wav: %d bytes is not a multiple of %d byte samples", len(pcm), w.format.BlockAlign())
+	}
+	if w.n+int64(len(pcm)) > maxData(w.format) {
+		return 0, errors.New("wav: file size limit reached")
+	}
+	n, err := w.w.Write(pcm)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
+
+// Size returns the size of the samples written
+func (w *Writer) Size() int64 { return w.n }
+
+// Duration returns the duration of the samples written
+func (w *Writer) Duration() time.Duration { return w.format.Duration(w.n) }
+
+// Close writes the header sizes, it does not close the underlying writer
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(header(w.format, w.n)); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+// RIFF header of a PCM WAV file of n bytes of samples
+func header(f Format, n int64) []byte {
+	b := make([]byte, 0, headerSize)
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(36+n))
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1) // PCM
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.Channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(f.Samplerate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(f.ByteRate()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.BlockAlign()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.Depth))
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(n))
+	return b
+}
@@ -0,0 +1,151 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+)
+
+// Packet of data in format f
+func packet(f Format, data []byte) lt.Packet {
+	meta, _ := json.Marshal(lt.AudioMetadata{Channels: f.Channels, Samplerate: f.Samplerate, Depth: f.Depth})
+	return lt.Packet{Media: "audio/pcm", Data: data, Meta: meta}
+}
+
+// File of a seekable buffer
+type seekBuffer struct {
+	b   []byte
+	off int
+}
+
+func (s *seekBuffer) Write(p []byte) (int, error) {
+	if n := s.off + len(p); n > len(s.b) {
+		s.b = append(s.b, make([]byte, n-len(s.b))...)
+	}
+	copy(s.b[s.off:], p)
+	s.off += len(p)
+	return len(p), nil
+}
+
+func (s *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		s.off = int(offset)
+	case io.SeekCurrent:
+		s.off += int(offset)
+	case io.SeekEnd:
+		s.off = len(s.b) + int(offset)
+	}
+	return int64(s.off), nil
+}
+
+func TestWriter(t *testing.T) {
+	f := Format{Channels: 2, Samplerate: 48000, Depth: 16}
+	var buf seekBuffer
+	w, err := NewWriter(&buf, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf.b) != 44 || string(buf.b[:4]) != "RIFF" || string(buf.b[8:16]) != "WAVEfmt " || string(buf.b[36:40]) != "data" {
+		t.Fatalf("header %q, want 44 bytes", buf.b)
+	}
+	if _, err := w.Write(make([]byte, 6)); err == nil {
+		t.Error("partial block written")
+	}
+	if _, err := w.Write(bytes.Repeat([]byte{1}, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Size() != 8 || w.Duration() != 2*time.Second/48000 {
+		t.Errorf("size %d and duration %v, want 8 and 2 samples", w.Size(), w.Duration())
+	}
+	if riff, data := binary.LittleEndian.Uint32(buf.b[4:]), binary.LittleEndian.Uint32(buf.b[40:]); riff != 36 || data != 0 {
+		t.Errorf("sizes %d and %d before Close, want 36 and 0", riff, data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(buf.b) != 52 {
+		t.Errorf("file of %d bytes, want 52", len(buf.b))
+	}
+	le := binary.LittleEndian
+	if riff, data := le.Uint32(buf.b[4:]), le.Uint32(buf.b[40:]); riff != 44 || data != 8 {
+		t.Errorf("sizes %d and %d after Close, want 44 and 8", riff, data)
+	}
+	if le.Uint16(buf.b[22:]) != 2 || le.Uint32(buf.b[24:]) != 48000 || le.Uint32(buf.b[28:]) != 192000 || le.Uint16(buf.b[32:]) != 4 || le.Uint16(buf.b[34:]) != 16 {
+		t.Errorf("format fields % x", buf.b[20:36])
+	}
+}
+
+// Sizes of the files written, samples only
+func sizes(t *testing.T, r *Recorder, header int) []int {
+	var n []int
+	for _, name := range r.Files() {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header > 0 && int(binary.LittleEndian.Uint32(b[40:])) != len(b)-header {
+			t.Errorf("%s: data size %d for %d bytes of samples", name, binary.LittleEndian.Uint32(b[40:]), len(b)-header)
+		}
+		n = append(n, len(b)-header)
+	}
+	return n
+}
+
+func TestRecorder(t *testing.T) {
+	mono := Format{Channels: 1, Samplerate: 1000, Depth: 16}
+	stereo := Format{Channels: 2, Samplerate: 1000, Depth: 16}
+	tests := []struct {
+		name    string
+		opts    Options
+		packets []lt.Packet
+		files   []string
+		sizes   []int
+	}{
+		// 10ms of 1000Hz 16 bit mono: 20 bytes per file
+		{"split", Options{Split: 10 * time.Millisecond}, []lt.Packet{packet(mono, make([]byte, 30)), packet(mono, make([]byte, 20))},
+			[]string{"audio-001.wav", "audio-002.wav", "audio-003.wav"}, []int{20, 20, 10}},
+		{"format change", Options{}, []lt.Packet{packet(stereo, make([]byte, 8)), packet(mono, make([]byte, 6))},
+			[]string{"audio-001.wav", "audio-002.wav"}, []int{8, 6}},
+		{"raw", Options{Raw: true, Name: "notes", Split: 10 * time.Millisecond}, []lt.Packet{packet(mono, make([]byte, 30))},
+			[]string{"notes-001.pcm", "notes-002.pcm"}, []int{20, 10}},
+		{"odd block", Options{}, []lt.Packet{packet(stereo, make([]byte, 10)), packet(stereo, nil)},
+			[]string{"audio-001.wav"}, []int{8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Dir = t.TempDir()
+			r := NewRecorder(tt.opts)
+			for _, p := range tt.packets {
+				if err := r.WritePacket(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, name := range r.Files() {
+				files = append(files, filepath.Base(name))
+			}
+			if !slices.Equal(files, tt.files) {
+				t.Fatalf("files %q, want %q", files, tt.files)
+			}
+			header := 44
+			if tt.opts.Raw {
+				header = 0
+			}
+			if got := sizes(t, r, header); !slices.Equal(got, tt.sizes) {
+				t.Errorf("sizes %v, want %v", got, tt.sizes)
+			}
+		})
+	}
+}
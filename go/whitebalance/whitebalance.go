@@ -0,0 +1,194 @@
+// Package whitebalance runs a one-push white balance: the camera is pointed at
+// a white target, eg gauze, and its balance gains are computed from live
+// frames until the center of the image is neutral.
+package whitebalance
+
+import (
+	"context"
+	"image"
+	"math"
+	"strings"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/frame"
+	"lt/client/go/stats"
+)
+
+// Range of the agent balance gains
+const maxBalance = 2.0
+
+// Failure is a target that cannot be balanced, its text is the reason shown
+// to users, eg "target too dark"
+type Failure string
+
+const (
+	TooDark       Failure = "target too dark"
+	Saturated     Failure = "target saturated"
+	NotWhite      Failure = "not white"
+	NoConvergence Failure = "no convergence"
+	GainLimit     Failure = "gain limit reached"
+	NoFrame       Failure = "no frame"
+)
+
+func (f Failure) Error() string { return string(f) }
+
+type Options struct {
+	Media      string        // Data worker media, "image/yuv422" by default
+	Center     float64       // Width and height ratios of the center region, 0.5 by default
+	MinLuma    float64       // Target mean luma below which it is too dark, 60 by default
+	MaxClipped float64       // Ratio of clipped highlights above which it is saturated, 0.02 by default
+	MaxGain    float64       // Correction above which, or below its inverse, it is not white, 1.6 by default
+	Tolerance  float64       // Correction within 1 ± Tolerance once converged, 0.03 by default
+	Iterations int           // Corrections applied before giving up, 3 by default
+	Settle     time.Duration // Delay for a correction to reach the frames, 300ms by default
+}
+
+func (o Options) withDefaults() Options {
+	if o.Media == "" {
+		o.Media = "image/yuv422"
+	}
+	if o.Center <= 0 || o.Center > 1 {
+		o.Center = 0.5
+	}
+	if o.MinLuma <= 0 {
+		o.MinLuma = 60
+	}
+	if o.MaxClipped <= 0 {
+		o.MaxClipped = 0.02
+	}
+	if o.MaxGain <= 1 {
+		o.MaxGain = 1.6
+	}
+	if o.Tolerance <= 0 {
+		o.Tolerance = 0.03
+	}
+	if o.Iterations <= 0 {
+		o.Iterations = 3
+	}
+	if o.Settle <= 0 {
+		o.Settle = 300 * time.Millisecond
+	}
+	return o
+}
+
+type Result struct {
+	Balance    [3]float64  // Applied red, green and blue gains
+	Previous   [3]float64  // Gains before the white balance
+	Iterations int         // Corrections applied, 0 if already balanced
+	Stats      stats.Stats // Center statistics of the last frame
+}
+
+// Run balances the camera, eg "cv40:/0/camera/0", and verifies the result on
+// a new frame. Gains are restored when the target fails the checks once
+// changed. Target failures are Failure errors, other errors agent ones.
+func Run(ctx context.Context, c lt.ContextCaller, camera string, opts Options) (Result, error) {
+	opts = opts.withDefaults()
+	url := strings.TrimSuffix(camera, "/") + "/white"
+	var white lt.CameraWhite
+	if err := c.GetContext(ctx, url, &white); err != nil {
+		return Result{}, err
+	}
+	for i, g := range white.Balance {
+		if g <= 0 {
+			white.Balance[i] = 1 // Not reported
+		}
+	}
+	r := Result{Balance: white.Balance, Previous: white.Balance}
+	restore := func(err error) (Result, error) {
+		if r.Iterations > 0 {
+			white.Balance = r.Previous
+			c.PostContext(context.WithoutCancel(ctx), url, white, nil)
+			r.Balance = r.Previous
+		}
+		return r, err
+	}
+
+	limited := false // A gain reached the agent range
+	for {
+		s, err := measure(ctx, c, camera, opts)
+		r.Stats = s
+		if err != nil {
+			return restore(err)
+		}
+		if err := check(s, opts); err != nil {
+			return restore(err)
+		}
+		g := s.Cast.Gains
+		if math.Abs(g[0]-1) <= opts.Tolerance && math.Abs(g[2]-1) <= opts.Tolerance {
+			return r, nil
+		}
+		if limited {
+			return restore(GainLimit)
+		}
+		if r.Iterations == opts.Iterations {
+			return restore(NoConvergence)
+		}
+
+		// Frames carry the current gains, corrections compound within the
+		// agent range. Once a channel is clamped, the frame of the clamped
+		// gains is the last one checked.
+		for i := range white.Balance {
+			white.Balance[i] = min(max(r.Balance[i]*g[i], 0), maxBalance)
+			limited = limited || white.Balance[i] == maxBalance
+		}
+		if err := c.PostContext(ctx, url, white, nil); err != nil {
+			return restore(err)
+		}
+		r.Balance = white.Balance
+		r.Iterations++
+		select {
+		case <-ctx.Done():
+			return restore(ctx.Err())
+		case <-time.After(opts.Settle):
+		}
+	}
+}
+
+// Statistics of the center region of a new frame
+func measure(ctx context.Context, c lt.ContextCaller, camera string, opts Options) (stats.Stats, error) {
+	h, err := lt.CreateDataWorker(ctx, c, camera, lt.ImageDataWorker{Media: opts.Media})
+	if err != nil {
+		return stats.Stats{}, err
+	}
+	// One frame is used, the worker is stopped whatever ctx
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+		defer cancel()
+		h.Discard(ctx)
+	}()
+	for p, err := range h.Packets(ctx) {
+		if err != nil {
+			return stats.Stats{}, err
+		}
+		img, err := frame.Decode(p)
+		p.Close()
+		if err != nil {
+			return stats.Stats{}, err
+		}
+		return stats.Compute(img, stats.Options{ROI: center(img.Bounds(), opts.Center)}), nil
+	}
+	return stats.Stats{}, NoFrame
+}
+
+func center(b image.Rectangle, ratio float64) image.Rectangle {
+	w, h := int(float64(b.Dx())*ratio), int(float64(b.Dy())*ratio)
+	x, y := b.Min.X+(b.Dx()-w)/2, b.Min.Y+(b.Dy()-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// The target must be bright, unsaturated and near neutral
+func check(s stats.Stats, opts Options) error {
+	switch {
+	case s.Luma.Mean < opts.MinLuma:
+		return TooDark
+	case s.Highlights > opts.MaxClipped:
+		return Saturated
+	}
+	for _, g := range s.Cast.Gains {
+		if g > opts.MaxGain || g < 1/opts.MaxGain {
+			return NotWhite
+		}
+	}
+	return nil
+}
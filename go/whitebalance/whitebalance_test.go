@@ -0,0 +1,85 @@
+package whitebalance_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image/color"
+	"testing"
+	"time"
+
+	lt "lt/client/go"
+	"lt/client/go/lttest"
+	"lt/client/go/whitebalance"
+)
+
+// A white target needs no correction, every frame worker ends
+func TestRunBalanced(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	// Planar yuv422 8x8 frames: bright luma, neutral chroma
+	const w, h = 8, 8
+	frame := append(bytes.Repeat([]byte{200}, w*h), bytes.Repeat([]byte{128}, w*h)...)
+	srv.OnWorker(func(worker *lttest.Worker) {
+		worker.Push(lttest.Packet{Data: frame, Meta: lt.ImageMetadata{Size: [2]int{w, h}}})
+	})
+	client := lt.NewPooledClient(lt.PoolConfig{})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := whitebalance.Run(ctx, client, srv.URL("/0/camera/0"), whitebalance.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Iterations != 0 || r.Balance != [3]float64{1, 1, 1} {
+		t.Errorf("result %d iterations to %v, want none at 1, 1, 1", r.Iterations, r.Balance)
+	}
+	workers := srv.Workers()
+	if len(workers) == 0 {
+		t.Fatal("no frame worker")
+	}
+	for _, w := range workers {
+		if w.Status() != "completed" {
+			t.Errorf("worker %s %s, want completed", w.Path, w.Status())
+		}
+	}
+}
+
+// A cast the balance does not correct stops at the agent gain range, the
+// previous gains are restored
+func TestRunGainLimit(t *testing.T) {
+	srv := lttest.NewServer()
+	defer srv.Close()
+	srv.Set("/0/camera/0/white", lt.CameraWhite{Balance: [3]float64{1.5, 1, 1}})
+	var posted [][3]float64
+	srv.Handle("POST", "/0/camera/0/white", func(req *lttest.Request) (any, error) {
+		var white lt.CameraWhite
+		json.Unmarshal(req.Body, &white)
+		posted = append(posted, white.Balance)
+		return white, nil
+	})
+	// Red at 2/3 of green and blue: a 1.5 red correction every frame
+	const w, h = 8, 8
+	y, cb, cr := color.RGBToYCbCr(120, 180, 180)
+	frame := append(bytes.Repeat([]byte{y}, w*h), append(bytes.Repeat([]byte{cb}, w*h/2), bytes.Repeat([]byte{cr}, w*h/2)...)...)
+	srv.OnWorker(func(worker *lttest.Worker) {
+		worker.Push(lttest.Packet{Data: frame, Meta: lt.ImageMetadata{Size: [2]int{w, h}}})
+	})
+	client := lt.NewPooledClient(lt.PoolConfig{})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := whitebalance.Run(ctx, client, srv.URL("/0/camera/0"), whitebalance.Options{Settle: time.Millisecond})
+	if !errors.Is(err, whitebalance.GainLimit) {
+		t.Fatalf("run: %v, want GainLimit", err)
+	}
+	if len(posted) != 2 || posted[0][0] != 2 || posted[1] != [3]float64{1.5, 1, 1} {
+		t.Errorf("posted gains %v, want red clamped to 2 then the previous gains", posted)
+	}
+	if r.Iterations != 1 || r.Balance != r.Previous {
+		t.Errorf("result %d iterations to %v, want 1 and the previous gains", r.Iterations, r.Balance)
+	}
+}